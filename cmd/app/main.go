@@ -1,29 +1,91 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/cors"
+	"github.com/joseph-gunnarsson/book-api/internal/cache"
+	"github.com/joseph-gunnarsson/book-api/internal/config"
 	"github.com/joseph-gunnarsson/book-api/internal/database"
+	"github.com/joseph-gunnarsson/book-api/internal/grpcapi"
+	"github.com/joseph-gunnarsson/book-api/internal/jobs"
+	"github.com/joseph-gunnarsson/book-api/internal/logging"
+	"github.com/joseph-gunnarsson/book-api/internal/metrics"
+	"github.com/joseph-gunnarsson/book-api/internal/middleware"
 	"github.com/joseph-gunnarsson/book-api/internal/models"
+	"github.com/joseph-gunnarsson/book-api/internal/ratelimit"
 	"github.com/joseph-gunnarsson/book-api/internal/routers"
+	"github.com/joseph-gunnarsson/book-api/internal/tracing"
+	"google.golang.org/grpc"
 )
 
 func main() {
-	err := database.InitDB()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Failed to load configuration:", err)
+	}
+
+	logger, err := logging.New(os.Stdout, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		log.Fatal("Failed to create logger:", err)
+	}
+	// Also routes the standard log package through the structured logger.
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TraceExporter, cfg.TraceEndpoint, cfg.ServiceName)
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
 
+	err = database.InitDB()
+
+	if err != nil {
+		fatal("Failed to initialize database", err)
+	}
+	database.DB.Logger = logging.NewGormLogger(cfg.SlowQueryThreshold)
+
+	err = metrics.InstrumentDB(database.DB)
 	if err != nil {
-		log.Fatal("Failed to initialize database:", err)
+		fatal("Failed to instrument database", err)
+	}
+	err = tracing.InstrumentDB(database.DB)
+	if err != nil {
+		fatal("Failed to instrument database", err)
+	}
+
+	if cfg.CacheMaxBytes > 0 {
+		models.SetCache(cache.NewLRU(cfg.CacheMaxBytes), cfg.CacheTTL)
 	}
+
 	// Drop and recreate tables
-	err = database.DB.Migrator().DropTable(&models.Author{}, &models.Book{}, &models.Genre{})
+	err = database.DB.Migrator().DropTable(&models.Author{}, &models.Book{}, &models.BookContributor{}, &models.Genre{}, &models.Publisher{}, &models.Series{}, &models.Work{}, &models.GenreAlias{})
+	if err != nil {
+		fatal("Failed to drop tables", err)
+	}
+	// Import jobs are kept across restarts so that queued imports resume.
+	database.DB.AutoMigrate(models.AllModels()...)
+	err = models.BackfillContributors(context.Background())
+	if err != nil {
+		fatal("Failed to backfill book contributors", err)
+	}
+	err = models.MigrateEditions(context.Background())
+	if err != nil {
+		fatal("Failed to migrate books to editions", err)
+	}
+	err = models.BackfillGenreSlugs(context.Background())
 	if err != nil {
-		log.Fatal("Failed to drop tables:", err)
+		fatal("Failed to backfill genre slugs", err)
 	}
-	database.DB.AutoMigrate(&models.Author{}, &models.Book{}, &models.Genre{})
 
 	// Insert dummy data
 	author := models.Author{
@@ -32,45 +94,206 @@ func main() {
 		Nationality: "British",
 		Website:     "https://www.jkrowling.com/",
 	}
-	err = models.CreateAuthor(&author)
+	err = models.CreateAuthor(context.Background(), &author)
 	if err != nil {
-		log.Println("Failed to create author:", err)
+		slog.Error("Failed to create author", "error", err)
 	}
 
 	genre1 := models.Genre{
 		Genre: "Fantasy",
 	}
-	err = models.CreateGenre(&genre1)
+	err = models.CreateGenre(context.Background(), &genre1)
 	if err != nil {
-		log.Println("Failed to create genre:", err)
+		slog.Error("Failed to create genre", "error", err)
 	}
 
 	genre2 := models.Genre{
 		Genre: "Adventure",
 	}
-	err = models.CreateGenre(&genre2)
+	err = models.CreateGenre(context.Background(), &genre2)
 	if err != nil {
-		log.Println("Failed to create genre:", err)
+		slog.Error("Failed to create genre", "error", err)
 	}
 
+	series := models.Series{
+		Name: "Harry Potter",
+	}
+	err = models.CreateSeries(context.Background(), &series)
+	if err != nil {
+		slog.Error("Failed to create series", "error", err)
+	}
+
+	seriesPosition := 1.0
+	pageCount := 309
 	book := models.Book{
-		Title:       "Harry Potter and the Sorcerer's Stone",
-		ReleaseDate: time.Date(1997, time.June, 26, 0, 0, 0, 0, time.UTC),
-		Genre:       []models.Genre{genre1, genre2},
-		Description: "The first book in the Harry Potter series.",
-		ISBN:        "97805903427",
-		AuthorID:    int(author.ID),
+		Title:          "Harry Potter and the Sorcerer's Stone",
+		ReleaseDate:    time.Date(1997, time.June, 26, 0, 0, 0, 0, time.UTC),
+		Genre:          []models.Genre{genre1, genre2},
+		Description:    "The first book in the Harry Potter series.",
+		ISBN:           "97805903427",
+		AuthorID:       int(author.ID),
+		SeriesID:       &series.ID,
+		SeriesPosition: &seriesPosition,
+		Format:         models.FormatHardcover,
+		PageCount:      &pageCount,
+		Language:       "en",
 	}
-	err = models.CreateBook(&book)
+	err = models.CreateBook(context.Background(), &book)
 	if err != nil {
-		log.Println("Failed to create book:", err)
+		slog.Error("Failed to create book", "error", err)
 	}
+
+	err = jobs.Start(context.Background(), cfg.ImportWorkers)
+	if err != nil {
+		fatal("Failed to start import workers", err)
+	}
+
+	routers.MaxBodyBytes = int64(cfg.MaxBodyBytes)
+	routers.MaxBulkBodyBytes = int64(cfg.MaxBulkBodyBytes)
+	routers.MaxImportBodyBytes = int64(cfg.MaxImportBytes)
+	routers.CacheMaxAge = cfg.HTTPCacheMaxAge
+
 	r := chi.NewRouter()
-	routers.BookRoutes(r)
-	routers.GenreRoutes(r)
-	routers.AuthorRoutes(r)
+	r.Use(
+		middleware.RequestID,
+		tracing.Middleware,
+		middleware.AccessLog,
+		metrics.Middleware,
+		// Recover runs inside the logging and metrics middleware so that
+		// panics are counted and logged as 500s.
+		middleware.Recover,
+		middleware.SecurityHeaders(cfg.HSTSMaxAge),
+	)
+	// An empty origin list would make cors allow every origin, so the
+	// middleware is only added when origins are configured.
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		r.Use(cors.Handler(cors.Options{
+			AllowedOrigins: cfg.CORSAllowedOrigins,
+			AllowedMethods: cfg.CORSAllowedMethods,
+			AllowedHeaders: cfg.CORSAllowedHeaders,
+			ExposedHeaders: []string{
+				"Location", middleware.RequestIDHeader, "Retry-After",
+				"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy",
+			},
+			AllowCredentials: cfg.CORSAllowCredentials,
+			MaxAge:           int(cfg.CORSMaxAge.Seconds()),
+		}))
+	}
+	r.Method(http.MethodGet, "/metrics", metrics.Handler())
+	routers.HealthRoutes(r)
+	routers.DocsRoutes(r)
+
+	// Probes and metrics scrapes come from a few addresses at a steady
+	// rate, so only the API itself is rate limited. Incompatible changes go
+	// into a new version mounted next to /v1, e.g. r.Route("/v2", ...),
+	// while /v1 routes are marked with Deprecation and Sunset headers.
+	limiter := ratelimit.Middleware(
+		ratelimit.NewMemoryStore(),
+		ratelimit.PerMinute(cfg.RateLimitRead, cfg.RateLimitReadBurst),
+		ratelimit.PerMinute(cfg.RateLimitWrite, cfg.RateLimitWriteBurst),
+	)
+	r.Route("/v1", func(r chi.Router) {
+		r.Use(limiter, middleware.Deprecation(cfg.Deprecations))
+		routers.V1Routes(r)
+	})
+	// GraphQL evolves its schema instead of versioning the endpoint. All
+	// operations are POSTs, so they count against the write budget.
+	r.Group(func(r chi.Router) {
+		r.Use(limiter)
+		routers.GraphQLRoutes(r)
+	})
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           r,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 2)
+	go func() {
+		slog.Info("Server started", "port", cfg.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	var grpcServer *grpc.Server
+	if cfg.GRPCPort != 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
+		if err != nil {
+			fatal("Failed to listen for gRPC", err)
+		}
+		grpcServer = grpcapi.NewServer()
+		go func() {
+			slog.Info("gRPC server started", "port", cfg.GRPCPort)
+			serverErr <- grpcServer.Serve(listener)
+		}()
+	}
+
+	exitCode := 0
+	select {
+	case err = <-serverErr:
+		slog.Error("Server failed", "error", err)
+		exitCode = 1
+	case <-ctx.Done():
+		slog.Info("Shutting down")
+	}
+	stop()
+
+	// Fail readiness first and give load balancers time to notice before
+	// the listener is closed.
+	routers.SetShuttingDown()
+	time.Sleep(cfg.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		slog.Error("Failed to drain connections", "error", err)
+	}
+	if grpcServer != nil {
+		stopGRPC(shutdownCtx, grpcServer)
+	}
+
+	err = jobs.Stop(shutdownCtx)
+	if err != nil {
+		slog.Error("Failed to stop import workers", "error", err)
+	}
+
+	err = shutdownTracing(shutdownCtx)
+	if err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+	cancel()
+
+	err = database.Close()
+	if err != nil {
+		slog.Error("Failed to close database", "error", err)
+	}
+	os.Exit(exitCode)
+}
+
+// stopGRPC waits for in-flight calls to finish, cancelling them when ctx
+// expires.
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		slog.Error("Failed to drain gRPC calls", "error", ctx.Err())
+		server.Stop()
+	}
+}
 
-	port := 8080
-	fmt.Printf("Server started on port %d\n", port)
-	http.ListenAndServe(fmt.Sprintf(":%d", port), r)
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
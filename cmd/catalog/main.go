@@ -0,0 +1,123 @@
+// Command catalog imports and exports books in the interchange formats
+// supported by the API, without going through HTTP.
+//
+//	catalog export [-format csv|marc|marcxml|onix] [-o file]
+//	catalog import [-format csv|marc|marcxml|onix] [-dry-run] [-report file] file
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/joseph-gunnarsson/book-api/internal/catalog"
+	"github.com/joseph-gunnarsson/book-api/internal/database"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	err := database.InitDB()
+	if err != nil {
+		log.Fatal("Failed to initialize database:", err)
+	}
+
+	switch os.Args[1] {
+	case "export":
+		err = runExport(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: catalog export [-format csv|marc|marcxml|onix] [-o file]")
+	fmt.Fprintln(os.Stderr, "       catalog import [-format csv|marc|marcxml|onix] [-dry-run] [-report file] file")
+	os.Exit(2)
+}
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	formatName := flags.String("format", "csv", "output format")
+	output := flags.String("o", "", "output file, stdout if empty")
+	flags.Parse(args)
+
+	format, err := catalog.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	return catalog.Export(context.Background(), w, format)
+}
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	formatName := flags.String("format", "csv", "input format")
+	dryRun := flags.Bool("dry-run", false, "report what would be imported without saving anything")
+	reportPath := flags.String("report", "", "write a CSV report of the failed rows to this file")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	format, err := catalog.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	records, rowErrors, err := catalog.Read(file, format)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", flags.Arg(0), err)
+	}
+
+	report, err := catalog.Import(context.Background(), records, catalog.ImportOptions{DryRun: *dryRun})
+	if err != nil {
+		return err
+	}
+	report.AddErrors(rowErrors)
+
+	if *reportPath != "" {
+		reportFile, err := os.Create(*reportPath)
+		if err != nil {
+			return err
+		}
+		defer reportFile.Close()
+
+		err = catalog.WriteErrorReport(reportFile, report.Errors)
+		if err != nil {
+			return err
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
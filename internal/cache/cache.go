@@ -0,0 +1,20 @@
+// Package cache provides a key-value cache for serialized query results.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache stores byte values under string keys. Implementations must be safe
+// for concurrent use. Keys are grouped by prefix, e.g. "books:", so that
+// related entries can be dropped together; a Redis backed implementation
+// would use SCAN with a MATCH pattern for DeletePrefix.
+type Cache interface {
+	// Get returns the value stored under key and whether it was found.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key for ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// DeletePrefix removes all keys starting with prefix.
+	DeletePrefix(ctx context.Context, prefix string) error
+}
@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LRU is an in-memory Cache holding up to maxBytes of keys and values.
+// When full, the least recently used entries are evicted. Expired entries
+// are dropped when they are read or evicted.
+type LRU struct {
+	mu       sync.Mutex
+	maxBytes int
+	size     int
+	entries  *list.List
+	items    map[string]*list.Element
+	now      func() time.Time
+}
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func (e *entry) size() int {
+	return len(e.key) + len(e.value)
+}
+
+func NewLRU(maxBytes int) *LRU {
+	return &LRU{
+		maxBytes: maxBytes,
+		entries:  list.New(),
+		items:    make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+func (c *LRU) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := elem.Value.(*entry)
+	if !c.now().Before(e.expires) {
+		c.remove(elem)
+		return nil, false, nil
+	}
+	c.entries.MoveToFront(elem)
+	return e.value, true, nil
+}
+
+func (c *LRU) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+	e := &entry{key: key, value: value, expires: c.now().Add(ttl)}
+	// Values that would take up the whole cache aren't worth evicting
+	// everything else for.
+	if e.size() > c.maxBytes/2 {
+		return nil
+	}
+	c.items[key] = c.entries.PushFront(e)
+	c.size += e.size()
+	for c.size > c.maxBytes {
+		c.remove(c.entries.Back())
+	}
+	return nil
+}
+
+func (c *LRU) DeletePrefix(ctx context.Context, prefix string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, elem := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(elem)
+		}
+	}
+	return nil
+}
+
+func (c *LRU) remove(elem *list.Element) {
+	e := c.entries.Remove(elem).(*entry)
+	delete(c.items, e.key)
+	c.size -= e.size()
+}
@@ -0,0 +1,178 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const csvDateLayout = "2006-01-02"
+
+var csvHeader = []string{"title", "isbn", "releaseDate", "description", "author", "genres"}
+
+type csvEncoder struct {
+	writer *csv.Writer
+}
+
+func newCSVEncoder(w io.Writer) (*csvEncoder, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	return &csvEncoder{writer: writer}, nil
+}
+
+func (e *csvEncoder) Encode(record Record) error {
+	releaseDate := ""
+	if !record.ReleaseDate.IsZero() {
+		releaseDate = record.ReleaseDate.Format(csvDateLayout)
+	}
+	return e.writer.Write(escapeCells([]string{
+		record.Title,
+		record.ISBN,
+		releaseDate,
+		record.Description,
+		record.AuthorName(),
+		strings.Join(record.Genres, ";"),
+	}))
+}
+
+// formulaPrefixes are the first characters that make spreadsheets read a
+// cell as a formula.
+const formulaPrefixes = "=+-@\t\r"
+
+// escapeCells prefixes cells that a spreadsheet would run as formulas with
+// a quote, so that exported text is shown as text. ReadCSV removes the
+// quote again.
+func escapeCells(cells []string) []string {
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune(formulaPrefixes, rune(cell[0])) {
+			cells[i] = "'" + cell
+		}
+	}
+	return cells
+}
+
+// unescapeCell reverses escapeCells.
+func unescapeCell(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
+
+func (e *csvEncoder) Flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvEncoder) Close() error {
+	return e.Flush()
+}
+
+// ReadCSV parses CSV in the format written by Export. Columns are matched
+// by header name, so their order doesn't matter and unknown columns are
+// ignored. Rows that can't be parsed are returned as row errors instead of
+// records.
+func ReadCSV(r io.Reader) ([]Record, []RowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, errors.New("CSV file is empty")
+		}
+		return nil, nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"title", "author"} {
+		if _, ok := columns[name]; !ok {
+			return nil, nil, fmt.Errorf("CSV header is missing the %q column", name)
+		}
+	}
+
+	var records []Record
+	var rowErrors []RowError
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rowErrors = append(rowErrors, RowError{Row: parseErr.StartLine, Error: parseErr.Err.Error()})
+				continue
+			}
+			return nil, nil, err
+		}
+		// Rows are numbered by line so they match what a spreadsheet shows.
+		row, _ := reader.FieldPos(0)
+
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(fields) {
+				return ""
+			}
+			return strings.TrimSpace(unescapeCell(fields[i]))
+		}
+
+		record := Record{
+			Row:         row,
+			Title:       field("title"),
+			ISBN:        NormalizeISBN(field("isbn")),
+			Description: field("description"),
+		}
+		record.AuthorFirstName, record.AuthorLastName = SplitAuthorName(field("author"))
+		for _, genre := range strings.Split(field("genres"), ";") {
+			if genre = strings.TrimSpace(genre); genre != "" {
+				record.Genres = append(record.Genres, genre)
+			}
+		}
+
+		if releaseDate := field("releaseDate"); releaseDate != "" {
+			record.ReleaseDate, err = parseDate(releaseDate)
+			if err != nil {
+				rowErrors = append(rowErrors, RowError{Row: row, Title: record.Title, Error: err.Error()})
+				continue
+			}
+		}
+
+		records = append(records, record)
+	}
+	return records, rowErrors, nil
+}
+
+// WriteErrorReport writes row errors as CSV so they can be fixed in a
+// spreadsheet next to the original file.
+func WriteErrorReport(w io.Writer, rowErrors []RowError) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"row", "title", "error"}); err != nil {
+		return err
+	}
+	for _, rowErr := range rowErrors {
+		if err := writer.Write(escapeCells([]string{fmt.Sprint(rowErr.Row), rowErr.Title, rowErr.Error})); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range []string{csvDateLayout, time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid release date %q, expected YYYY-MM-DD", value)
+}
@@ -0,0 +1,127 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+)
+
+// Format is a catalogue interchange format.
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatMARC    Format = "marc"
+	FormatMARCXML Format = "marcxml"
+	FormatONIX    Format = "onix"
+)
+
+// ParseFormat validates a format name. An empty name selects CSV.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case "":
+		return FormatCSV, nil
+	case FormatCSV, FormatMARC, FormatMARCXML, FormatONIX:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown format %q", name)
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatMARC:
+		return "application/marc"
+	case FormatMARCXML:
+		return "application/marcxml+xml"
+	case FormatONIX:
+		return "application/xml"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+func (f Format) FileExtension() string {
+	switch f {
+	case FormatMARC:
+		return ".mrc"
+	case FormatMARCXML, FormatONIX:
+		return ".xml"
+	}
+	return ".csv"
+}
+
+// encoder writes records one at a time so exports can be streamed.
+type encoder interface {
+	Encode(record Record) error
+	Flush() error
+	// Close writes any trailer required by the format and flushes.
+	Close() error
+}
+
+func newEncoder(w io.Writer, format Format) (encoder, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVEncoder(w)
+	case FormatMARC:
+		return newMARCEncoder(w), nil
+	case FormatMARCXML:
+		return newMARCXMLEncoder(w)
+	case FormatONIX:
+		return newONIXEncoder(w)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// Export writes every book in the given format. Books are loaded in batches
+// and the output is flushed after each batch so large catalogues can be
+// streamed.
+func Export(ctx context.Context, w io.Writer, format Format) error {
+	enc, err := newEncoder(w, format)
+	if err != nil {
+		return err
+	}
+
+	err = models.FindBooksInBatches(ctx, func(books []models.Book) error {
+		for _, book := range books {
+			if err := enc.Encode(RecordFromBook(book)); err != nil {
+				return err
+			}
+		}
+
+		if err := enc.Flush(); err != nil {
+			return err
+		}
+		if f, ok := w.(flusher); ok {
+			f.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Read parses records in the given format. Records that can't be parsed are
+// returned as row errors; the error is only set if the input as a whole is
+// unreadable.
+func Read(r io.Reader, format Format) ([]Record, []RowError, error) {
+	switch format {
+	case FormatCSV:
+		return ReadCSV(r)
+	case FormatMARC:
+		return ReadMARC(r)
+	case FormatMARCXML:
+		return ReadMARCXML(r)
+	case FormatONIX:
+		return ReadONIX(r)
+	}
+	return nil, nil, fmt.Errorf("unknown format %q", format)
+}
+
+// flusher is implemented by writers that buffer output, such as
+// http.ResponseWriter.
+type flusher interface {
+	Flush()
+}
@@ -0,0 +1,162 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/joseph-gunnarsson/book-api/internal/database"
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// Report summarises an import.
+type Report struct {
+	DryRun         bool       `json:"dryRun"`
+	Total          int        `json:"total"`
+	Created        int        `json:"created"`
+	Failed         int        `json:"failed"`
+	AuthorsCreated int        `json:"authorsCreated"`
+	GenresCreated  int        `json:"genresCreated"`
+	Errors         []RowError `json:"errors"`
+}
+
+// ImportOptions controls how Import runs.
+type ImportOptions struct {
+	DryRun bool
+	// Progress, if set, is called with the report so far after each record.
+	Progress func(Report)
+	// Finish, if set, is called with the report in the import transaction
+	// after the last record, so that what it writes is committed together
+	// with the import. An error rolls the import back. It isn't called for
+	// dry runs.
+	Finish func(tx *gorm.DB, report Report) error
+}
+
+// errDryRun rolls back the import transaction of a dry run.
+var errDryRun = errors.New("dry run")
+
+// Import creates a book for every record, creating missing authors and genres
+// by name. Each record is imported in its own savepoint so a failing row
+// doesn't affect the others. A dry run performs the same work and then rolls
+// everything back, so the report shows exactly what a real import would do.
+//
+// The whole import is a single transaction, so if ctx is cancelled nothing is
+// saved and ctx.Err() is returned.
+func Import(ctx context.Context, records []Record, options ImportOptions) (Report, error) {
+	report := Report{
+		DryRun: options.DryRun,
+		Total:  len(records),
+		Errors: []RowError{},
+	}
+
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, record := range records {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var authorsCreated, genresCreated int
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				var err error
+				authorsCreated, genresCreated, err = importRecord(tx, record)
+				return err
+			})
+			if err != nil {
+				report.Failed++
+				report.Errors = append(report.Errors, RowError{Row: record.Row, Title: record.Title, Error: err.Error()})
+			} else {
+				report.Created++
+				report.AuthorsCreated += authorsCreated
+				report.GenresCreated += genresCreated
+			}
+
+			if options.Progress != nil {
+				options.Progress(report)
+			}
+		}
+
+		if options.DryRun {
+			return errDryRun
+		}
+		if options.Finish != nil {
+			return options.Finish(tx, report)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return Report{}, ctxErr
+		}
+		return Report{}, err
+	}
+	if !options.DryRun {
+		models.InvalidateCache(ctx, models.CacheBooks, models.CacheAuthors, models.CacheGenres)
+	}
+	return report, nil
+}
+
+// AddErrors merges errors found while parsing the source file into the report.
+func (r *Report) AddErrors(rowErrors []RowError) {
+	r.Total += len(rowErrors)
+	r.Failed += len(rowErrors)
+	r.Errors = append(r.Errors, rowErrors...)
+	sort.SliceStable(r.Errors, func(i, j int) bool {
+		return r.Errors[i].Row < r.Errors[j].Row
+	})
+}
+
+func importRecord(tx *gorm.DB, record Record) (int, int, error) {
+	if record.Title == "" {
+		return 0, 0, errors.New("title is required")
+	}
+	if record.AuthorName() == "" {
+		return 0, 0, errors.New("author is required")
+	}
+
+	if record.ReleaseDate.IsZero() {
+		return 0, 0, errors.New("release date is required")
+	}
+
+	authorsCreated := 0
+	var author models.Author
+	err := tx.Where("first_name = ? AND last_name = ?", record.AuthorFirstName, record.AuthorLastName).First(&author).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		author = models.Author{FirstName: record.AuthorFirstName, LastName: record.AuthorLastName}
+		err = tx.Create(&author).Error
+		authorsCreated++
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to find or create author %q: %w", record.AuthorName(), err)
+	}
+
+	genresCreated := 0
+	genres := make([]models.Genre, 0, len(record.Genres))
+	for _, name := range record.Genres {
+		var genre models.Genre
+		err := tx.Where("genre = ?", name).First(&genre).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			genre = models.Genre{Genre: name}
+			err = tx.Create(&genre).Error
+			genresCreated++
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to find or create genre %q: %w", name, err)
+		}
+		genres = append(genres, genre)
+	}
+
+	book := models.Book{
+		Title:       record.Title,
+		ISBN:        record.ISBN,
+		ReleaseDate: record.ReleaseDate,
+		Description: record.Description,
+		AuthorID:    int(author.ID),
+		Genre:       genres,
+	}
+	if err := tx.Omit("Author").Create(&book).Error; err != nil {
+		return 0, 0, err
+	}
+	return authorsCreated, genresCreated, nil
+}
@@ -0,0 +1,465 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MARC21 bibliographic records, in the ISO 2709 binary transmission format
+// and as MARCXML. Books are mapped to these fields:
+//
+//	001     book ID
+//	008     fixed length data, with the release year as Date 1
+//	020 $a  ISBN
+//	046 $k  full release date as yyyymmdd
+//	100 $a  author, as "Last, First"
+//	245 $a  title
+//	264 $c  release year
+//	520 $a  description
+//	650 $a  genres, as topical subject headings
+//
+// On import 260 $c is accepted in place of 264 $c and 655 $a (genre/form)
+// headings are treated as genres as well.
+
+const (
+	marcSubfieldDelimiter = 0x1F
+	marcFieldTerminator   = 0x1E
+	marcRecordTerminator  = 0x1D
+
+	marcLeaderLength    = 24
+	marcDirectoryLength = 12
+
+	// New record, language material, monograph, UTF-8, ISBD punctuation.
+	marcDefaultLeader = "00000nam a2200000 i 4500"
+
+	marcXMLNamespace = "http://www.loc.gov/MARC21/slim"
+)
+
+var marcYear = regexp.MustCompile(`\d{4}`)
+
+type marcRecord struct {
+	XMLName       xml.Name           `xml:"record"`
+	Leader        string             `xml:"leader"`
+	ControlFields []marcControlField `xml:"controlfield"`
+	DataFields    []marcDataField    `xml:"datafield"`
+}
+
+type marcControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcDataField struct {
+	Tag       string         `xml:"tag,attr"`
+	Ind1      string         `xml:"ind1,attr"`
+	Ind2      string         `xml:"ind2,attr"`
+	Subfields []marcSubfield `xml:"subfield"`
+}
+
+type marcSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+func marcFromRecord(record Record) marcRecord {
+	m := marcRecord{Leader: marcDefaultLeader}
+	if record.ID != 0 {
+		m.ControlFields = append(m.ControlFields, marcControlField{Tag: "001", Value: strconv.FormatUint(uint64(record.ID), 10)})
+	}
+	m.ControlFields = append(m.ControlFields, marcControlField{Tag: "008", Value: marcFixedField(record.ReleaseDate)})
+
+	addField := func(tag, ind1, ind2 string, subfields ...marcSubfield) {
+		m.DataFields = append(m.DataFields, marcDataField{Tag: tag, Ind1: ind1, Ind2: ind2, Subfields: subfields})
+	}
+
+	if record.ISBN != "" {
+		addField("020", " ", " ", marcSubfield{Code: "a", Value: record.ISBN})
+	}
+	if !record.ReleaseDate.IsZero() {
+		addField("046", " ", " ", marcSubfield{Code: "k", Value: record.ReleaseDate.Format("20060102")})
+	}
+	switch {
+	case record.AuthorFirstName != "":
+		addField("100", "1", " ", marcSubfield{Code: "a", Value: record.AuthorLastName + ", " + record.AuthorFirstName})
+	case record.AuthorLastName != "":
+		addField("100", "0", " ", marcSubfield{Code: "a", Value: record.AuthorLastName})
+	}
+	addField("245", "1", "0", marcSubfield{Code: "a", Value: record.Title})
+	if !record.ReleaseDate.IsZero() {
+		addField("264", " ", "1", marcSubfield{Code: "c", Value: record.ReleaseDate.Format("2006")})
+	}
+	if record.Description != "" {
+		addField("520", " ", " ", marcSubfield{Code: "a", Value: record.Description})
+	}
+	for _, genre := range record.Genres {
+		addField("650", " ", "4", marcSubfield{Code: "a", Value: genre})
+	}
+	return m
+}
+
+// marcFixedField builds the 40 character 008 field. Only the date entered,
+// the date type and Date 1 are filled in.
+func marcFixedField(releaseDate time.Time) string {
+	field := []byte(strings.Repeat(" ", 40))
+	copy(field[0:6], time.Now().Format("060102"))
+	if !releaseDate.IsZero() {
+		field[6] = 's'
+		copy(field[7:11], releaseDate.Format("2006"))
+	} else {
+		field[6] = 'n'
+		copy(field[7:11], "uuuu")
+	}
+	copy(field[15:18], "xx ")
+	copy(field[35:38], "und")
+	return string(field)
+}
+
+func (m marcRecord) toRecord() Record {
+	var record Record
+
+	if id, err := strconv.ParseUint(m.controlField("001"), 10, 64); err == nil {
+		record.ID = uint(id)
+	}
+	record.ISBN = NormalizeISBN(m.subfield("020", "a"))
+
+	title := trimISBDPunctuation(m.subfield("245", "a"))
+	if subtitle := trimISBDPunctuation(m.subfield("245", "b")); subtitle != "" {
+		title += ": " + subtitle
+	}
+	record.Title = title
+
+	if name := trimISBDPunctuation(m.subfield("100", "a")); name != "" {
+		if last, first, ok := strings.Cut(name, ","); ok {
+			record.AuthorFirstName, record.AuthorLastName = strings.TrimSpace(first), strings.TrimSpace(last)
+		} else {
+			record.AuthorFirstName, record.AuthorLastName = SplitAuthorName(name)
+		}
+	}
+
+	record.Description = m.subfield("520", "a")
+	record.ReleaseDate = m.releaseDate()
+
+	for _, field := range m.DataFields {
+		if field.Tag != "650" && field.Tag != "655" {
+			continue
+		}
+		for _, subfield := range field.Subfields {
+			if subfield.Code == "a" {
+				if genre := strings.TrimSuffix(trimISBDPunctuation(subfield.Value), "."); genre != "" {
+					record.Genres = append(record.Genres, genre)
+				}
+			}
+		}
+	}
+	return record
+}
+
+// releaseDate returns the most precise release date in the record, falling
+// back from 046 to the publication statement and then to the 008 field.
+func (m marcRecord) releaseDate() time.Time {
+	if value := m.subfield("046", "k"); value != "" {
+		for _, layout := range []string{"20060102", "200601", "2006"} {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t
+			}
+		}
+	}
+
+	statement := m.subfield("264", "c")
+	if statement == "" {
+		statement = m.subfield("260", "c")
+	}
+	year := marcYear.FindString(statement)
+	if fixed := m.controlField("008"); year == "" && len(fixed) >= 11 {
+		year = fixed[7:11]
+	}
+	if t, err := time.Parse("2006", year); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+func (m marcRecord) controlField(tag string) string {
+	for _, field := range m.ControlFields {
+		if field.Tag == tag {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// subfield returns the first subfield with the given code in the first field
+// with the given tag.
+func (m marcRecord) subfield(tag, code string) string {
+	for _, field := range m.DataFields {
+		if field.Tag != tag {
+			continue
+		}
+		for _, subfield := range field.Subfields {
+			if subfield.Code == code {
+				return strings.TrimSpace(subfield.Value)
+			}
+		}
+	}
+	return ""
+}
+
+// trimISBDPunctuation removes the punctuation cataloguers put between
+// subfields, e.g. the " /" ending a 245 $a.
+func trimISBDPunctuation(value string) string {
+	return strings.TrimRight(strings.TrimSpace(value), " /:;,=")
+}
+
+// MarshalBinary encodes the record in ISO 2709 format.
+func (m marcRecord) MarshalBinary() ([]byte, error) {
+	var directory, data bytes.Buffer
+	addField := func(tag string, field []byte) {
+		fmt.Fprintf(&directory, "%3s%04d%05d", tag, len(field)+1, data.Len())
+		data.Write(field)
+		data.WriteByte(marcFieldTerminator)
+	}
+
+	for _, field := range m.ControlFields {
+		addField(field.Tag, []byte(field.Value))
+	}
+	for _, field := range m.DataFields {
+		var buf bytes.Buffer
+		buf.WriteString(marcIndicator(field.Ind1))
+		buf.WriteString(marcIndicator(field.Ind2))
+		for _, subfield := range field.Subfields {
+			buf.WriteByte(marcSubfieldDelimiter)
+			buf.WriteString(subfield.Code)
+			buf.WriteString(subfield.Value)
+		}
+		addField(field.Tag, buf.Bytes())
+	}
+	directory.WriteByte(marcFieldTerminator)
+
+	baseAddress := marcLeaderLength + directory.Len()
+	length := baseAddress + data.Len() + 1
+	if length > 99999 {
+		return nil, fmt.Errorf("record is %d bytes, longer than the MARC21 limit of 99999", length)
+	}
+
+	leader := []byte(m.Leader)
+	if len(leader) != marcLeaderLength {
+		leader = []byte(marcDefaultLeader)
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", length))
+	copy(leader[10:12], "22")
+	copy(leader[12:17], fmt.Sprintf("%05d", baseAddress))
+	copy(leader[20:24], "4500")
+
+	out := make([]byte, 0, length)
+	out = append(out, leader...)
+	out = append(out, directory.Bytes()...)
+	out = append(out, data.Bytes()...)
+	out = append(out, marcRecordTerminator)
+	return out, nil
+}
+
+// parseMARCNumber parses a fixed-width number of the leader or directory.
+// Unlike strconv.Atoi it only accepts digits, so signs can't make offsets
+// negative.
+func parseMARCNumber(digits []byte) (int, error) {
+	n := 0
+	for _, digit := range digits {
+		if digit < '0' || digit > '9' {
+			return 0, fmt.Errorf("%q is not a number", digits)
+		}
+		n = n*10 + int(digit-'0')
+	}
+	return n, nil
+}
+
+// UnmarshalBinary decodes a record in ISO 2709 format.
+func (m *marcRecord) UnmarshalBinary(data []byte) error {
+	if len(data) < marcLeaderLength+1 {
+		return errors.New("record is shorter than the MARC21 leader")
+	}
+	m.Leader = string(data[:marcLeaderLength])
+
+	baseAddress, err := parseMARCNumber(data[12:17])
+	if err != nil || baseAddress <= marcLeaderLength || baseAddress > len(data) {
+		return fmt.Errorf("invalid base address of data %q", data[12:17])
+	}
+
+	directory := bytes.TrimSuffix(data[marcLeaderLength:baseAddress], []byte{marcFieldTerminator})
+	if len(directory)%marcDirectoryLength != 0 {
+		return errors.New("malformed record directory")
+	}
+
+	m.ControlFields = nil
+	m.DataFields = nil
+	for i := 0; i < len(directory); i += marcDirectoryLength {
+		entry := directory[i : i+marcDirectoryLength]
+		tag := string(entry[0:3])
+		length, err1 := parseMARCNumber(entry[3:7])
+		start, err2 := parseMARCNumber(entry[7:12])
+		if err1 != nil || err2 != nil || length < 1 || baseAddress+start+length > len(data) {
+			return fmt.Errorf("invalid directory entry for field %s", tag)
+		}
+		field := bytes.TrimSuffix(data[baseAddress+start:baseAddress+start+length], []byte{marcFieldTerminator})
+
+		if tag < "010" {
+			m.ControlFields = append(m.ControlFields, marcControlField{Tag: tag, Value: string(field)})
+			continue
+		}
+		if len(field) < 2 {
+			return fmt.Errorf("field %s is missing its indicators", tag)
+		}
+
+		dataField := marcDataField{Tag: tag, Ind1: string(field[0]), Ind2: string(field[1])}
+		for _, subfield := range bytes.Split(field[2:], []byte{marcSubfieldDelimiter}) {
+			if len(subfield) == 0 {
+				continue
+			}
+			dataField.Subfields = append(dataField.Subfields, marcSubfield{Code: string(subfield[0]), Value: string(subfield[1:])})
+		}
+		m.DataFields = append(m.DataFields, dataField)
+	}
+	return nil
+}
+
+func marcIndicator(indicator string) string {
+	if len(indicator) != 1 {
+		return " "
+	}
+	return indicator
+}
+
+type marcEncoder struct {
+	writer *bufio.Writer
+}
+
+func newMARCEncoder(w io.Writer) *marcEncoder {
+	return &marcEncoder{writer: bufio.NewWriter(w)}
+}
+
+func (e *marcEncoder) Encode(record Record) error {
+	data, err := marcFromRecord(record).MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("book %q: %w", record.Title, err)
+	}
+	_, err = e.writer.Write(data)
+	return err
+}
+
+func (e *marcEncoder) Flush() error {
+	return e.writer.Flush()
+}
+
+func (e *marcEncoder) Close() error {
+	return e.Flush()
+}
+
+// ReadMARC parses concatenated binary MARC21 records. Rows in the returned
+// errors are the position of the record in the file, starting at 1.
+func ReadMARC(r io.Reader) ([]Record, []RowError, error) {
+	reader := bufio.NewReader(r)
+
+	var records []Record
+	var rowErrors []RowError
+	for row := 1; ; row++ {
+		data, err := reader.ReadBytes(marcRecordTerminator)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, nil, err
+		}
+		// Files often end with a newline after the last record.
+		if len(bytes.TrimSpace(data)) == 0 {
+			break
+		}
+
+		var m marcRecord
+		if unmarshalErr := m.UnmarshalBinary(bytes.TrimLeft(data, "\r\n")); unmarshalErr != nil {
+			rowErrors = append(rowErrors, RowError{Row: row, Error: unmarshalErr.Error()})
+		} else {
+			record := m.toRecord()
+			record.Row = row
+			records = append(records, record)
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+	return records, rowErrors, nil
+}
+
+type marcXMLEncoder struct {
+	writer  io.Writer
+	encoder *xml.Encoder
+}
+
+func newMARCXMLEncoder(w io.Writer) (*marcXMLEncoder, error) {
+	_, err := fmt.Fprintf(w, "%s<collection xmlns=%q>\n", xml.Header, marcXMLNamespace)
+	if err != nil {
+		return nil, err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return &marcXMLEncoder{writer: w, encoder: encoder}, nil
+}
+
+func (e *marcXMLEncoder) Encode(record Record) error {
+	return e.encoder.Encode(marcFromRecord(record))
+}
+
+func (e *marcXMLEncoder) Flush() error {
+	return e.encoder.Flush()
+}
+
+func (e *marcXMLEncoder) Close() error {
+	if err := e.encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.writer, "\n</collection>\n")
+	return err
+}
+
+// ReadMARCXML parses MARCXML, either a collection or a single record.
+func ReadMARCXML(r io.Reader) ([]Record, []RowError, error) {
+	var records []Record
+	err := decodeXMLElements(r, "record", func(row int, d *xml.Decoder, start xml.StartElement) error {
+		var m marcRecord
+		if err := d.DecodeElement(&m, &start); err != nil {
+			return err
+		}
+		record := m.toRecord()
+		record.Row = row
+		records = append(records, record)
+		return nil
+	})
+	return records, nil, err
+}
+
+// decodeXMLElements calls fn for every element with the given local name,
+// numbering them from 1. Namespaces are ignored so that prefixed documents
+// are read the same way as unprefixed ones.
+func decodeXMLElements(r io.Reader, name string, fn func(row int, d *xml.Decoder, start xml.StartElement) error) error {
+	decoder := xml.NewDecoder(r)
+	row := 0
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == name {
+			row++
+			if err := fn(row, decoder, start); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package catalog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMARCRecordUnmarshalBinaryRejectsBadDirectory(t *testing.T) {
+	tests := map[string]string{
+		"negative length and start": "245-005-0001",
+		"zero length":               "245000000000",
+		"past the end":              "245001300001",
+		"plus sign":                 "245+00500001",
+	}
+	for name, entry := range tests {
+		t.Run(name, func(t *testing.T) {
+			data := "00050nam a2200037 i 4500" + entry + "\x1e"
+			data += strings.Repeat("x", 50-len(data))
+
+			var record marcRecord
+			err := record.UnmarshalBinary([]byte(data))
+			if err == nil {
+				t.Fatal("UnmarshalBinary succeeded, want a decode error")
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package catalog
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ONIX for Books 3.0 messages using reference tag names. Each book becomes a
+// Product with its ISBN as product identifier, the title, the author as
+// contributor A01, genres as keyword subjects, the description as text type 03
+// and the release date as publishing date role 01.
+
+const onixNamespace = "http://ns.editeur.org/onix/3.0/reference"
+
+// Code list values used by the mapping.
+const (
+	onixProductIDTypeISBN10  = "02"
+	onixProductIDTypeGTIN13  = "03"
+	onixProductIDTypeISBN13  = "15"
+	onixTitleTypeDistinctive = "01"
+	onixTitleElementProduct  = "01"
+	onixRoleAuthor           = "A01"
+	onixSubjectKeywords      = "20"
+	onixTextTypeShortDesc    = "02"
+	onixTextTypeDescription  = "03"
+	onixPublicationDate      = "01"
+	onixDateFormatYYYYMMDD   = "00"
+)
+
+type onixHeader struct {
+	XMLName      xml.Name `xml:"Header"`
+	SenderName   string   `xml:"Sender>SenderName"`
+	SentDateTime string   `xml:"SentDateTime"`
+}
+
+type onixProduct struct {
+	XMLName            xml.Name                `xml:"Product"`
+	RecordReference    string                  `xml:"RecordReference"`
+	NotificationType   string                  `xml:"NotificationType"`
+	ProductIdentifiers []onixProductIdentifier `xml:"ProductIdentifier"`
+	DescriptiveDetail  onixDescriptiveDetail   `xml:"DescriptiveDetail"`
+	CollateralDetail   *onixCollateralDetail   `xml:"CollateralDetail"`
+	PublishingDetail   *onixPublishingDetail   `xml:"PublishingDetail"`
+}
+
+type onixProductIdentifier struct {
+	ProductIDType string `xml:"ProductIDType"`
+	IDValue       string `xml:"IDValue"`
+}
+
+type onixDescriptiveDetail struct {
+	ProductComposition string            `xml:"ProductComposition"`
+	ProductForm        string            `xml:"ProductForm"`
+	TitleDetails       []onixTitleDetail `xml:"TitleDetail"`
+	Contributors       []onixContributor `xml:"Contributor"`
+	Subjects           []onixSubject     `xml:"Subject"`
+}
+
+type onixTitleDetail struct {
+	TitleType     string             `xml:"TitleType"`
+	TitleElements []onixTitleElement `xml:"TitleElement"`
+}
+
+type onixTitleElement struct {
+	TitleElementLevel  string `xml:"TitleElementLevel"`
+	TitleText          string `xml:"TitleText,omitempty"`
+	TitlePrefix        string `xml:"TitlePrefix,omitempty"`
+	TitleWithoutPrefix string `xml:"TitleWithoutPrefix,omitempty"`
+	Subtitle           string `xml:"Subtitle,omitempty"`
+}
+
+type onixContributor struct {
+	SequenceNumber   int      `xml:"SequenceNumber,omitempty"`
+	ContributorRoles []string `xml:"ContributorRole"`
+	PersonName       string   `xml:"PersonName,omitempty"`
+	NamesBeforeKey   string   `xml:"NamesBeforeKey,omitempty"`
+	KeyNames         string   `xml:"KeyNames,omitempty"`
+}
+
+type onixSubject struct {
+	SubjectSchemeIdentifier string `xml:"SubjectSchemeIdentifier"`
+	SubjectCode             string `xml:"SubjectCode,omitempty"`
+	SubjectHeadingText      string `xml:"SubjectHeadingText,omitempty"`
+}
+
+type onixCollateralDetail struct {
+	TextContents []onixTextContent `xml:"TextContent"`
+}
+
+type onixTextContent struct {
+	TextType        string `xml:"TextType"`
+	ContentAudience string `xml:"ContentAudience"`
+	Text            string `xml:"Text"`
+}
+
+type onixPublishingDetail struct {
+	PublishingDates []onixPublishingDate `xml:"PublishingDate"`
+}
+
+type onixPublishingDate struct {
+	PublishingDateRole string   `xml:"PublishingDateRole"`
+	Date               onixDate `xml:"Date"`
+}
+
+type onixDate struct {
+	Format string `xml:"dateformat,attr,omitempty"`
+	Value  string `xml:",chardata"`
+}
+
+func onixFromRecord(record Record) onixProduct {
+	product := onixProduct{
+		RecordReference:  fmt.Sprintf("book-api.%d", record.ID),
+		NotificationType: "03",
+		DescriptiveDetail: onixDescriptiveDetail{
+			ProductComposition: "00",
+			ProductForm:        "BA",
+			TitleDetails: []onixTitleDetail{{
+				TitleType: onixTitleTypeDistinctive,
+				TitleElements: []onixTitleElement{{
+					TitleElementLevel: onixTitleElementProduct,
+					TitleText:         record.Title,
+				}},
+			}},
+		},
+	}
+
+	if record.ISBN != "" {
+		idType := onixProductIDTypeISBN13
+		if len(record.ISBN) == 10 {
+			idType = onixProductIDTypeISBN10
+		}
+		product.ProductIdentifiers = append(product.ProductIdentifiers, onixProductIdentifier{ProductIDType: idType, IDValue: record.ISBN})
+	}
+
+	if record.AuthorName() != "" {
+		product.DescriptiveDetail.Contributors = append(product.DescriptiveDetail.Contributors, onixContributor{
+			SequenceNumber:   1,
+			ContributorRoles: []string{onixRoleAuthor},
+			NamesBeforeKey:   record.AuthorFirstName,
+			KeyNames:         record.AuthorLastName,
+		})
+	}
+
+	for _, genre := range record.Genres {
+		product.DescriptiveDetail.Subjects = append(product.DescriptiveDetail.Subjects, onixSubject{
+			SubjectSchemeIdentifier: onixSubjectKeywords,
+			SubjectHeadingText:      genre,
+		})
+	}
+
+	if record.Description != "" {
+		product.CollateralDetail = &onixCollateralDetail{
+			TextContents: []onixTextContent{{
+				TextType:        onixTextTypeDescription,
+				ContentAudience: "00",
+				Text:            record.Description,
+			}},
+		}
+	}
+
+	if !record.ReleaseDate.IsZero() {
+		product.PublishingDetail = &onixPublishingDetail{
+			PublishingDates: []onixPublishingDate{{
+				PublishingDateRole: onixPublicationDate,
+				Date:               onixDate{Format: onixDateFormatYYYYMMDD, Value: record.ReleaseDate.Format("20060102")},
+			}},
+		}
+	}
+	return product
+}
+
+func (p onixProduct) toRecord() Record {
+	var record Record
+
+	isbns := map[string]string{}
+	for _, identifier := range p.ProductIdentifiers {
+		isbns[identifier.ProductIDType] = NormalizeISBN(identifier.IDValue)
+	}
+	for _, idType := range []string{onixProductIDTypeISBN13, onixProductIDTypeGTIN13, onixProductIDTypeISBN10} {
+		if isbn := isbns[idType]; isbn != "" {
+			record.ISBN = isbn
+			break
+		}
+	}
+
+	for _, detail := range p.DescriptiveDetail.TitleDetails {
+		if detail.TitleType != onixTitleTypeDistinctive {
+			continue
+		}
+		for _, element := range detail.TitleElements {
+			if element.TitleElementLevel != onixTitleElementProduct {
+				continue
+			}
+			title := element.TitleText
+			if title == "" {
+				title = strings.TrimSpace(element.TitlePrefix + " " + element.TitleWithoutPrefix)
+			}
+			if element.Subtitle != "" {
+				title += ": " + element.Subtitle
+			}
+			record.Title = strings.TrimSpace(title)
+		}
+	}
+
+	if contributor, ok := p.author(); ok {
+		if contributor.KeyNames != "" {
+			record.AuthorFirstName = strings.TrimSpace(contributor.NamesBeforeKey)
+			record.AuthorLastName = strings.TrimSpace(contributor.KeyNames)
+		} else {
+			record.AuthorFirstName, record.AuthorLastName = SplitAuthorName(contributor.PersonName)
+		}
+	}
+
+	for _, subject := range p.DescriptiveDetail.Subjects {
+		if heading := strings.TrimSpace(subject.SubjectHeadingText); heading != "" {
+			record.Genres = append(record.Genres, heading)
+		}
+	}
+
+	if p.CollateralDetail != nil {
+		texts := map[string]string{}
+		for _, text := range p.CollateralDetail.TextContents {
+			texts[text.TextType] = strings.TrimSpace(text.Text)
+		}
+		record.Description = texts[onixTextTypeDescription]
+		if record.Description == "" {
+			record.Description = texts[onixTextTypeShortDesc]
+		}
+	}
+
+	if p.PublishingDetail != nil {
+		for _, date := range p.PublishingDetail.PublishingDates {
+			if date.PublishingDateRole == onixPublicationDate {
+				record.ReleaseDate = parseONIXDate(date.Date)
+			}
+		}
+	}
+	return record
+}
+
+// author returns the first contributor with the author role, or the first
+// contributor if none has it.
+func (p onixProduct) author() (onixContributor, bool) {
+	contributors := p.DescriptiveDetail.Contributors
+	for _, contributor := range contributors {
+		for _, role := range contributor.ContributorRoles {
+			if role == onixRoleAuthor {
+				return contributor, true
+			}
+		}
+	}
+	if len(contributors) > 0 {
+		return contributors[0], true
+	}
+	return onixContributor{}, false
+}
+
+// parseONIXDate supports the day, month and year precision formats from code
+// list 55. Other formats are ignored.
+func parseONIXDate(date onixDate) time.Time {
+	layouts := map[string]string{
+		"":   "20060102",
+		"00": "20060102",
+		"01": "200601",
+		"05": "2006",
+	}
+	layout, ok := layouts[date.Format]
+	if !ok {
+		return time.Time{}
+	}
+	t, err := time.Parse(layout, strings.TrimSpace(date.Value))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+type onixEncoder struct {
+	writer  io.Writer
+	encoder *xml.Encoder
+}
+
+func newONIXEncoder(w io.Writer) (*onixEncoder, error) {
+	_, err := fmt.Fprintf(w, "%s<ONIXMessage release=\"3.0\" xmlns=%q>\n", xml.Header, onixNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	header := onixHeader{
+		SenderName:   "book-api",
+		SentDateTime: time.Now().UTC().Format("20060102T1504Z"),
+	}
+	if err := encoder.Encode(header); err != nil {
+		return nil, err
+	}
+	return &onixEncoder{writer: w, encoder: encoder}, nil
+}
+
+func (e *onixEncoder) Encode(record Record) error {
+	return e.encoder.Encode(onixFromRecord(record))
+}
+
+func (e *onixEncoder) Flush() error {
+	return e.encoder.Flush()
+}
+
+func (e *onixEncoder) Close() error {
+	if err := e.encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.writer, "\n</ONIXMessage>\n")
+	return err
+}
+
+// ReadONIX parses the Product elements of an ONIX 3.0 message. Only reference
+// tag names are supported.
+func ReadONIX(r io.Reader) ([]Record, []RowError, error) {
+	var records []Record
+	err := decodeXMLElements(r, "Product", func(row int, d *xml.Decoder, start xml.StartElement) error {
+		var product onixProduct
+		if err := d.DecodeElement(&product, &start); err != nil {
+			return err
+		}
+		record := product.toRecord()
+		record.Row = row
+		records = append(records, record)
+		return nil
+	})
+	return records, nil, err
+}
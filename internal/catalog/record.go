@@ -0,0 +1,84 @@
+package catalog
+
+import (
+	"strings"
+	"time"
+
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+)
+
+// Record is the flat representation of a book shared by the import and export
+// formats. Authors and genres are referenced by name rather than by ID so that
+// records can be moved between databases.
+type Record struct {
+	// Row is the position of the record in its source file, used in error
+	// reports. It is zero for records that were not read from a file.
+	Row int
+	// ID is the ID of the exported book. It is ignored on import.
+	ID              uint
+	Title           string
+	ISBN            string
+	ReleaseDate     time.Time
+	Description     string
+	AuthorFirstName string
+	AuthorLastName  string
+	Genres          []string
+}
+
+// RowError describes why a record could not be imported.
+type RowError struct {
+	Row   int    `json:"row"`
+	Title string `json:"title,omitempty"`
+	Error string `json:"error"`
+}
+
+func RecordFromBook(book models.Book) Record {
+	record := Record{
+		ID:              book.ID,
+		Title:           book.Title,
+		ISBN:            book.ISBN,
+		ReleaseDate:     book.ReleaseDate,
+		Description:     book.Description,
+		AuthorFirstName: book.Author.FirstName,
+		AuthorLastName:  book.Author.LastName,
+	}
+	for _, genre := range book.Genre {
+		record.Genres = append(record.Genres, genre.Genre)
+	}
+	return record
+}
+
+// AuthorName joins the author's first and last name.
+func (r Record) AuthorName() string {
+	return strings.TrimSpace(r.AuthorFirstName + " " + r.AuthorLastName)
+}
+
+// SplitAuthorName splits a full name on its last space, so "J.K. Rowling"
+// becomes "J.K." and "Rowling".
+func SplitAuthorName(name string) (string, string) {
+	name = strings.TrimSpace(name)
+	i := strings.LastIndex(name, " ")
+	if i < 0 {
+		return "", name
+	}
+	return strings.TrimSpace(name[:i]), name[i+1:]
+}
+
+// NormalizeISBN strips hyphens, spaces and trailing qualifiers such as
+// "(hardcover)" from an ISBN.
+func NormalizeISBN(isbn string) string {
+	isbn = strings.TrimSpace(isbn)
+	if i := strings.IndexAny(isbn, " ("); i >= 0 {
+		// Qualifiers are separated by a space, but so are the groups of
+		// some printed ISBNs, so only cut when the rest isn't digits.
+		if strings.Trim(isbn[i:], " -0123456789Xx") != "" {
+			isbn = isbn[:i]
+		}
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, isbn)
+}
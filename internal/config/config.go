@@ -0,0 +1,250 @@
+// Package config reads the server configuration from environment variables.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Port int
+	// GRPCPort is the port of the gRPC server. Zero disables it.
+	GRPCPort int
+
+	// LogFormat is "json" or "text" and LogLevel one of "debug", "info",
+	// "warn" or "error".
+	LogFormat string
+	LogLevel  string
+	// SlowQueryThreshold is the duration above which database queries are
+	// logged as warnings. Zero disables slow query logging.
+	SlowQueryThreshold time.Duration
+
+	// HTTP server timeouts. Handlers that stream large files, like the
+	// catalogue import and export, lift the read and write deadlines for
+	// their own requests.
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// ShutdownTimeout is how long in-flight requests and import jobs get to
+	// finish after SIGINT or SIGTERM before the server exits anyway.
+	ShutdownTimeout time.Duration
+	// ShutdownDelay is how long the server keeps accepting requests after a
+	// signal while reporting itself as not ready. In Kubernetes it should be
+	// a few seconds longer than the readiness probe period.
+	ShutdownDelay time.Duration
+
+	// ImportWorkers is the number of import jobs processed concurrently.
+	ImportWorkers int
+
+	// TraceExporter is "none", "stdout" or "otlp". TraceEndpoint is the
+	// OTLP/HTTP collector address; when empty the standard
+	// OTEL_EXPORTER_OTLP_* variables are used.
+	TraceExporter string
+	TraceEndpoint string
+	ServiceName   string
+
+	// MaxBodyBytes and MaxBulkBodyBytes limit the size of JSON request
+	// bodies for single resources and bulk requests, and MaxImportBytes the
+	// size of uploaded import files.
+	MaxBodyBytes     int
+	MaxBulkBodyBytes int
+	MaxImportBytes   int
+	// HSTSMaxAge is sent in the Strict-Transport-Security header. Zero
+	// disables the header.
+	HSTSMaxAge time.Duration
+
+	// CORS policy. CORSAllowedOrigins is a comma-separated list of origins,
+	// which may contain a wildcard like https://*.example.com; when empty,
+	// cross-origin requests are not allowed.
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration
+
+	// Rate limits per client in requests per minute, with the burst being
+	// how many requests may be made at once. Reads are GET, HEAD and
+	// OPTIONS requests. A zero rate disables the limit.
+	RateLimitRead       int
+	RateLimitReadBurst  int
+	RateLimitWrite      int
+	RateLimitWriteBurst int
+
+	// CacheMaxBytes is the size of the in-process cache of query results
+	// and CacheTTL how long results are kept. A zero size disables the
+	// cache. HTTPCacheMaxAge is the max-age sent to clients for read
+	// endpoints.
+	CacheMaxBytes   int
+	CacheTTL        time.Duration
+	HTTPCacheMaxAge time.Duration
+
+	// Deprecations maps routes to their deprecation policy. Keys are chi
+	// route patterns including the version prefix, optionally preceded by
+	// a method, e.g. "/v1/books/{id}" or "DELETE /v1/books/{id}". They are
+	// read from DEPRECATIONS as a JSON object.
+	Deprecations map[string]Deprecation
+}
+
+// Deprecation describes when a route was or will be deprecated, when it
+// will be removed and where to read about it. Zero values are omitted from
+// the response headers.
+type Deprecation struct {
+	Deprecation time.Time `json:"deprecation"`
+	Sunset      time.Time `json:"sunset"`
+	Link        string    `json:"link"`
+}
+
+// Load reads the configuration, using defaults for unset variables.
+func Load() (Config, error) {
+	var cfg Config
+	var err error
+
+	if cfg.Port, err = getInt("PORT", 8080); err != nil {
+		return Config{}, err
+	}
+	if cfg.GRPCPort, err = getInt("GRPC_PORT", 9090); err != nil {
+		return Config{}, err
+	}
+	cfg.LogFormat = getString("LOG_FORMAT", "json")
+	cfg.LogLevel = getString("LOG_LEVEL", "info")
+	if cfg.SlowQueryThreshold, err = getDuration("DB_SLOW_QUERY_THRESHOLD", 200*time.Millisecond); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReadTimeout, err = getDuration("HTTP_READ_TIMEOUT", 15*time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReadHeaderTimeout, err = getDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.WriteTimeout, err = getDuration("HTTP_WRITE_TIMEOUT", 30*time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.IdleTimeout, err = getDuration("HTTP_IDLE_TIMEOUT", 120*time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.ShutdownTimeout, err = getDuration("SHUTDOWN_TIMEOUT", 30*time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.ShutdownDelay, err = getDuration("SHUTDOWN_DELAY", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.ImportWorkers, err = getInt("IMPORT_WORKERS", 2); err != nil {
+		return Config{}, err
+	}
+	cfg.TraceExporter = getString("TRACE_EXPORTER", "none")
+	cfg.TraceEndpoint = getString("TRACE_ENDPOINT", "")
+	cfg.ServiceName = getString("OTEL_SERVICE_NAME", "book-api")
+	if cfg.MaxBodyBytes, err = getInt("MAX_BODY_BYTES", 1<<20); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxBulkBodyBytes, err = getInt("MAX_BULK_BODY_BYTES", 32<<20); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxImportBytes, err = getInt("MAX_IMPORT_BYTES", 64<<20); err != nil {
+		return Config{}, err
+	}
+	if cfg.HSTSMaxAge, err = getDuration("HSTS_MAX_AGE", 365*24*time.Hour); err != nil {
+		return Config{}, err
+	}
+	cfg.CORSAllowedOrigins = getList("CORS_ALLOWED_ORIGINS", nil)
+	cfg.CORSAllowedMethods = getList("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE"})
+	cfg.CORSAllowedHeaders = getList("CORS_ALLOWED_HEADERS", []string{"Accept", "Authorization", "Content-Type", "X-API-Key", "X-Request-ID"})
+	if cfg.CORSAllowCredentials, err = getBool("CORS_ALLOW_CREDENTIALS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.CORSMaxAge, err = getDuration("CORS_MAX_AGE", 10*time.Minute); err != nil {
+		return Config{}, err
+	}
+	if cfg.RateLimitRead, err = getInt("RATE_LIMIT_READ", 600); err != nil {
+		return Config{}, err
+	}
+	if cfg.RateLimitReadBurst, err = getInt("RATE_LIMIT_READ_BURST", 100); err != nil {
+		return Config{}, err
+	}
+	if cfg.RateLimitWrite, err = getInt("RATE_LIMIT_WRITE", 60); err != nil {
+		return Config{}, err
+	}
+	if cfg.RateLimitWriteBurst, err = getInt("RATE_LIMIT_WRITE_BURST", 10); err != nil {
+		return Config{}, err
+	}
+	if cfg.CacheMaxBytes, err = getInt("CACHE_MAX_BYTES", 64<<20); err != nil {
+		return Config{}, err
+	}
+	if cfg.CacheTTL, err = getDuration("CACHE_TTL", time.Minute); err != nil {
+		return Config{}, err
+	}
+	if cfg.HTTPCacheMaxAge, err = getDuration("HTTP_CACHE_MAX_AGE", 0); err != nil {
+		return Config{}, err
+	}
+	if value := getString("DEPRECATIONS", ""); value != "" {
+		if err = json.Unmarshal([]byte(value), &cfg.Deprecations); err != nil {
+			return Config{}, fmt.Errorf("invalid DEPRECATIONS: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+func getString(name, fallback string) string {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return fallback
+	}
+	return value
+}
+
+// getList splits a comma-separated variable, dropping empty items.
+func getList(name string, fallback []string) []string {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return fallback
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getBool(name string, fallback bool) (bool, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return b, nil
+}
+
+func getInt(name string, fallback int) (int, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return n, nil
+}
+
+func getDuration(name string, fallback time.Duration) (time.Duration, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return d, nil
+}
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"context"
+
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
@@ -8,7 +10,7 @@ import (
 var DB *gorm.DB
 
 func InitDB() error {
-	dsn := "root:102938@tcp(127.0.0.1:3306)/bookDB?charset=utf8&parseTime=True&loc=Local"
+	dsn := "root:102938@tcp(127.0.0.1:3306)/bookDB?charset=utf8mb4&parseTime=True&loc=Local"
 
 	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
 
@@ -21,3 +23,21 @@ func InitDB() error {
 	DB = db
 	return nil
 }
+
+// Close closes the connection pool.
+func Close() error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// Ping checks that the database is reachable.
+func Ping(ctx context.Context) error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
@@ -0,0 +1,88 @@
+// Package graph implements the GraphQL schema over books, authors and
+// genres. Relations are resolved through per-request dataloaders so that a
+// query costs one database query per level of nesting rather than one per
+// object.
+package graph
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/joseph-gunnarsson/book-api/internal/logging"
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+	"gorm.io/gorm"
+)
+
+//go:embed schema.graphql
+var schema string
+
+const (
+	// maxDepth bounds nesting like author.books.author.books..., which
+	// would otherwise let a small query load the whole catalogue many
+	// times over.
+	maxDepth = 8
+	// maxLimit is the largest page size of list queries.
+	maxLimit = 100
+)
+
+// NewSchema parses the schema and binds it to the resolvers. Requests must
+// be executed with a context returned by WithLoaders.
+func NewSchema() *graphql.Schema {
+	return graphql.MustParseSchema(schema, &Resolver{},
+		graphql.MaxDepth(maxDepth),
+		graphql.Logger(panicLogger{}),
+	)
+}
+
+type panicLogger struct{}
+
+func (panicLogger) LogPanic(ctx context.Context, value interface{}) {
+	logging.FromContext(ctx).Error("GraphQL resolver panicked", slog.String("panic", fmt.Sprint(value)))
+}
+
+func parseID(id graphql.ID) (uint, error) {
+	n, err := strconv.ParseUint(string(id), 10, 0)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID %q", id)
+	}
+	return uint(n), nil
+}
+
+func formatID(id uint) graphql.ID {
+	return graphql.ID(strconv.FormatUint(uint64(id), 10))
+}
+
+func parseIDs(ids []graphql.ID) ([]uint, error) {
+	parsed := make([]uint, len(ids))
+	for i, id := range ids {
+		n, err := parseID(id)
+		if err != nil {
+			return nil, err
+		}
+		parsed[i] = n
+	}
+	return parsed, nil
+}
+
+func toPage(limit, offset int32) (models.Page, error) {
+	if limit < 1 || limit > maxLimit {
+		return models.Page{}, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+	}
+	if offset < 0 {
+		return models.Page{}, errors.New("offset must not be negative")
+	}
+	return models.Page{Limit: int(limit), Offset: int(offset)}, nil
+}
+
+// notFound turns a missing record into a null result.
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/graph-gophers/dataloader/v7"
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+)
+
+type loadersKey struct{}
+
+type loaders struct {
+	author        *dataloader.Loader[uint, models.Author]
+	booksByAuthor *dataloader.Loader[uint, []models.Book]
+	booksByGenre  *dataloader.Loader[uint, []models.Book]
+	genresByBook  *dataloader.Loader[uint, []models.Genre]
+}
+
+// WithLoaders returns a context carrying fresh dataloaders. Loaders cache
+// what they load, so they must not outlive a request.
+func WithLoaders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loadersKey{}, &loaders{
+		author:        dataloader.NewBatchedLoader(loadAuthors),
+		booksByAuthor: dataloader.NewBatchedLoader(groupedLoader(models.GetBooksByAuthorIDs)),
+		booksByGenre:  dataloader.NewBatchedLoader(groupedLoader(models.GetBooksByGenreIDs)),
+		genresByBook:  dataloader.NewBatchedLoader(groupedLoader(models.GetGenresByBookIDs)),
+	})
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+func loadAuthors(ctx context.Context, ids []uint) []*dataloader.Result[models.Author] {
+	results := make([]*dataloader.Result[models.Author], len(ids))
+	authors, err := models.GetAuthorsByIDs(ctx, ids)
+	if err != nil {
+		for i := range results {
+			results[i] = &dataloader.Result[models.Author]{Error: err}
+		}
+		return results
+	}
+
+	byID := make(map[uint]models.Author, len(authors))
+	for _, author := range authors {
+		byID[author.ID] = author
+	}
+	for i, id := range ids {
+		// Books can't exist without their author, so a missing author
+		// has been deleted since the book was loaded.
+		author, ok := byID[id]
+		if !ok {
+			results[i] = &dataloader.Result[models.Author]{Error: fmt.Errorf("author with ID %d does not exist", id)}
+			continue
+		}
+		results[i] = &dataloader.Result[models.Author]{Data: author}
+	}
+	return results
+}
+
+// groupedLoader adapts a function loading the children of many parents at
+// once to a dataloader batch function. Parents without children get an
+// empty list.
+func groupedLoader[V any](load func(context.Context, []uint) (map[uint][]V, error)) dataloader.BatchFunc[uint, []V] {
+	return func(ctx context.Context, ids []uint) []*dataloader.Result[[]V] {
+		results := make([]*dataloader.Result[[]V], len(ids))
+		children, err := load(ctx, ids)
+		for i, id := range ids {
+			if err != nil {
+				results[i] = &dataloader.Result[[]V]{Error: err}
+				continue
+			}
+			list := children[id]
+			if list == nil {
+				list = []V{}
+			}
+			results[i] = &dataloader.Result[[]V]{Data: list}
+		}
+		return results
+	}
+}
@@ -0,0 +1,266 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+)
+
+type bookInput struct {
+	Title       string
+	ISBN        string
+	ReleaseDate graphql.Time
+	Description *string
+	AuthorID    graphql.ID
+	GenreIDs    *[]graphql.ID
+}
+
+type bookUpdate struct {
+	Title       *string
+	ISBN        *string
+	ReleaseDate *graphql.Time
+	Description *string
+	AuthorID    *graphql.ID
+	GenreIDs    *[]graphql.ID
+}
+
+type authorInput struct {
+	FirstName   string
+	LastName    string
+	Nationality *string
+	Website     *string
+}
+
+type authorUpdate struct {
+	FirstName   *string
+	LastName    *string
+	Nationality *string
+	Website     *string
+}
+
+type genreInput struct {
+	Name string
+}
+
+func (r *Resolver) CreateBook(ctx context.Context, args struct{ Input bookInput }) (*bookResolver, error) {
+	authorID, err := parseID(args.Input.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+	book := models.Book{
+		Title:       args.Input.Title,
+		ISBN:        args.Input.ISBN,
+		ReleaseDate: args.Input.ReleaseDate.Time,
+		AuthorID:    int(authorID),
+	}
+	if args.Input.Description != nil {
+		book.Description = *args.Input.Description
+	}
+	if args.Input.GenreIDs != nil {
+		if book.Genre, err = genresByID(*args.Input.GenreIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	err = models.CreateBook(ctx, &book)
+	if err != nil {
+		return nil, err
+	}
+	return r.loadBook(ctx, book.ID)
+}
+
+func (r *Resolver) UpdateBook(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input bookUpdate
+}) (*bookResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := models.GetBookById(ctx, int(id)); err != nil {
+		return nil, err
+	}
+
+	book := models.Book{Model: modelID(id)}
+	input := args.Input
+	if input.Title != nil {
+		book.Title = *input.Title
+	}
+	if input.ISBN != nil {
+		book.ISBN = *input.ISBN
+	}
+	if input.ReleaseDate != nil {
+		book.ReleaseDate = input.ReleaseDate.Time
+	}
+	if input.Description != nil {
+		book.Description = *input.Description
+	}
+	if input.AuthorID != nil {
+		authorID, err := parseID(*input.AuthorID)
+		if err != nil {
+			return nil, err
+		}
+		book.AuthorID = int(authorID)
+	}
+	if input.GenreIDs != nil {
+		if book.Genre, err = genresByID(*input.GenreIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	err = models.UpdateBook(ctx, &book, nil)
+	if err != nil {
+		return nil, err
+	}
+	return r.loadBook(ctx, id)
+}
+
+func (r *Resolver) DeleteBook(ctx context.Context, args struct{ ID graphql.ID }) (graphql.ID, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return "", err
+	}
+	err = models.DeleteBookByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return args.ID, nil
+}
+
+func (r *Resolver) CreateAuthor(ctx context.Context, args struct{ Input authorInput }) (*authorResolver, error) {
+	author := models.Author{
+		FirstName: args.Input.FirstName,
+		LastName:  args.Input.LastName,
+	}
+	if args.Input.Nationality != nil {
+		author.Nationality = *args.Input.Nationality
+	}
+	if args.Input.Website != nil {
+		author.Website = *args.Input.Website
+	}
+
+	err := models.CreateAuthor(ctx, &author)
+	if err != nil {
+		return nil, err
+	}
+	return &authorResolver{author}, nil
+}
+
+func (r *Resolver) UpdateAuthor(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input authorUpdate
+}) (*authorResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := models.GetAuthor(ctx, id); err != nil {
+		return nil, err
+	}
+
+	author := models.Author{Model: modelID(id)}
+	input := args.Input
+	if input.FirstName != nil {
+		author.FirstName = *input.FirstName
+	}
+	if input.LastName != nil {
+		author.LastName = *input.LastName
+	}
+	if input.Nationality != nil {
+		author.Nationality = *input.Nationality
+	}
+	if input.Website != nil {
+		author.Website = *input.Website
+	}
+
+	err = models.UpdateAuthor(ctx, &author)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := models.GetAuthor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &authorResolver{updated}, nil
+}
+
+func (r *Resolver) DeleteAuthor(ctx context.Context, args struct{ ID graphql.ID }) (graphql.ID, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return "", err
+	}
+	author, err := models.GetAuthor(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	err = models.DeleteAuthor(ctx, &author)
+	if err != nil {
+		return "", err
+	}
+	return args.ID, nil
+}
+
+func (r *Resolver) CreateGenre(ctx context.Context, args struct{ Input genreInput }) (*genreResolver, error) {
+	genre := models.Genre{Genre: args.Input.Name}
+	err := models.CreateGenre(ctx, &genre)
+	if err != nil {
+		return nil, err
+	}
+	return &genreResolver{genre}, nil
+}
+
+func (r *Resolver) UpdateGenre(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input genreInput
+}) (*genreResolver, error) {
+	existing, _, err := models.FindGenre(ctx, string(args.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	genre := models.Genre{Model: modelID(existing.ID), Genre: args.Input.Name}
+	err = models.UpdateGenre(ctx, &genre)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := models.GetGenre(ctx, existing.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &genreResolver{updated}, nil
+}
+
+func (r *Resolver) DeleteGenre(ctx context.Context, args struct{ ID graphql.ID }) (graphql.ID, error) {
+	genre, _, err := models.FindGenre(ctx, string(args.ID))
+	if err != nil {
+		return "", err
+	}
+	err = models.DeleteGenre(ctx, &genre)
+	if err != nil {
+		return "", err
+	}
+	return formatID(genre.ID), nil
+}
+
+func (r *Resolver) loadBook(ctx context.Context, id uint) (*bookResolver, error) {
+	book, err := models.GetBookById(ctx, int(id))
+	if err != nil {
+		return nil, err
+	}
+	return &bookResolver{book}, nil
+}
+
+// genresByID turns genre IDs into genres to attach to a book. An empty
+// list is kept non-nil so that it removes all genres on update.
+func genresByID(ids []graphql.ID) ([]models.Genre, error) {
+	parsed, err := parseIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	genres := make([]models.Genre, len(parsed))
+	for i, id := range parsed {
+		genres[i] = models.Genre{Model: modelID(id)}
+	}
+	return genres, nil
+}
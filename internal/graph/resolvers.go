@@ -0,0 +1,237 @@
+package graph
+
+import (
+	"context"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// Resolver is the root resolver of queries and mutations. Mutations go
+// through the same model functions as the REST handlers.
+type Resolver struct{}
+
+type bookFilterInput struct {
+	Title            *string
+	ISBN             *string
+	AuthorID         *graphql.ID
+	Genre            *string
+	IncludeSubgenres *bool
+	ReleasedAfter    *graphql.Time
+	ReleasedBefore   *graphql.Time
+}
+
+type authorFilterInput struct {
+	Name        *string
+	Nationality *string
+}
+
+func (r *Resolver) Book(ctx context.Context, args struct{ ID graphql.ID }) (*bookResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	book, err := models.GetBookById(ctx, int(id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &bookResolver{book}, nil
+}
+
+func (r *Resolver) Books(ctx context.Context, args struct {
+	Filter *bookFilterInput
+	Limit  int32
+	Offset int32
+}) ([]*bookResolver, error) {
+	page, err := toPage(args.Limit, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	var filter models.BookFilter
+	if f := args.Filter; f != nil {
+		if f.Title != nil {
+			filter.Title = *f.Title
+		}
+		if f.ISBN != nil {
+			filter.ISBN = *f.ISBN
+		}
+		if f.AuthorID != nil {
+			if filter.AuthorID, err = parseID(*f.AuthorID); err != nil {
+				return nil, err
+			}
+		}
+		if f.Genre != nil {
+			filter.Genre = *f.Genre
+		}
+		if f.IncludeSubgenres != nil {
+			filter.IncludeSubgenres = *f.IncludeSubgenres
+		}
+		if f.ReleasedAfter != nil {
+			filter.ReleasedAfter = &f.ReleasedAfter.Time
+		}
+		if f.ReleasedBefore != nil {
+			filter.ReleasedBefore = &f.ReleasedBefore.Time
+		}
+	}
+
+	books, err := models.FindBooks(ctx, filter, models.Sort{}, page)
+	if err != nil {
+		return nil, err
+	}
+	return bookResolvers(books), nil
+}
+
+func (r *Resolver) Author(ctx context.Context, args struct{ ID graphql.ID }) (*authorResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	author, err := models.GetAuthor(ctx, id)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &authorResolver{author}, nil
+}
+
+func (r *Resolver) Authors(ctx context.Context, args struct {
+	Filter *authorFilterInput
+	Limit  int32
+	Offset int32
+}) ([]*authorResolver, error) {
+	page, err := toPage(args.Limit, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	var filter models.AuthorFilter
+	if f := args.Filter; f != nil {
+		if f.Name != nil {
+			filter.Name = *f.Name
+		}
+		if f.Nationality != nil {
+			filter.Nationality = *f.Nationality
+		}
+	}
+
+	authors, err := models.FindAuthors(ctx, filter, page)
+	if err != nil {
+		return nil, err
+	}
+	resolvers := make([]*authorResolver, len(authors))
+	for i, author := range authors {
+		resolvers[i] = &authorResolver{author}
+	}
+	return resolvers, nil
+}
+
+func (r *Resolver) Genre(ctx context.Context, args struct{ ID graphql.ID }) (*genreResolver, error) {
+	genre, _, err := models.FindGenre(ctx, string(args.ID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &genreResolver{genre}, nil
+}
+
+func (r *Resolver) Genres(ctx context.Context, args struct {
+	Limit  int32
+	Offset int32
+}) ([]*genreResolver, error) {
+	page, err := toPage(args.Limit, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+	genres, err := models.FindGenres(ctx, page)
+	if err != nil {
+		return nil, err
+	}
+	return genreResolvers(genres), nil
+}
+
+type bookResolver struct {
+	book models.Book
+}
+
+func bookResolvers(books []models.Book) []*bookResolver {
+	resolvers := make([]*bookResolver, len(books))
+	for i, book := range books {
+		resolvers[i] = &bookResolver{book}
+	}
+	return resolvers
+}
+
+func (b *bookResolver) ID() graphql.ID            { return formatID(b.book.ID) }
+func (b *bookResolver) Title() string             { return b.book.Title }
+func (b *bookResolver) ISBN() string              { return b.book.ISBN }
+func (b *bookResolver) ReleaseDate() graphql.Time { return graphql.Time{Time: b.book.ReleaseDate} }
+func (b *bookResolver) Description() string       { return b.book.Description }
+
+func (b *bookResolver) Author(ctx context.Context) (*authorResolver, error) {
+	// Books fetched by ID come with their author preloaded.
+	if b.book.Author.ID != 0 {
+		return &authorResolver{b.book.Author}, nil
+	}
+	author, err := loadersFrom(ctx).author.Load(ctx, uint(b.book.AuthorID))()
+	if err != nil {
+		return nil, err
+	}
+	return &authorResolver{author}, nil
+}
+
+func (b *bookResolver) Genres(ctx context.Context) ([]*genreResolver, error) {
+	if b.book.Genre != nil {
+		return genreResolvers(b.book.Genre), nil
+	}
+	genres, err := loadersFrom(ctx).genresByBook.Load(ctx, b.book.ID)()
+	if err != nil {
+		return nil, err
+	}
+	return genreResolvers(genres), nil
+}
+
+type authorResolver struct {
+	author models.Author
+}
+
+func (a *authorResolver) ID() graphql.ID      { return formatID(a.author.ID) }
+func (a *authorResolver) FirstName() string   { return a.author.FirstName }
+func (a *authorResolver) LastName() string    { return a.author.LastName }
+func (a *authorResolver) Nationality() string { return a.author.Nationality }
+func (a *authorResolver) Website() string     { return a.author.Website }
+
+func (a *authorResolver) Books(ctx context.Context) ([]*bookResolver, error) {
+	books, err := loadersFrom(ctx).booksByAuthor.Load(ctx, a.author.ID)()
+	if err != nil {
+		return nil, err
+	}
+	return bookResolvers(books), nil
+}
+
+type genreResolver struct {
+	genre models.Genre
+}
+
+func genreResolvers(genres []models.Genre) []*genreResolver {
+	resolvers := make([]*genreResolver, len(genres))
+	for i, genre := range genres {
+		resolvers[i] = &genreResolver{genre}
+	}
+	return resolvers
+}
+
+func (g *genreResolver) ID() graphql.ID { return formatID(g.genre.ID) }
+func (g *genreResolver) Name() string   { return g.genre.Genre }
+func (g *genreResolver) Slug() string   { return g.genre.Slug }
+
+func (g *genreResolver) Books(ctx context.Context) ([]*bookResolver, error) {
+	books, err := loadersFrom(ctx).booksByGenre.Load(ctx, g.genre.ID)()
+	if err != nil {
+		return nil, err
+	}
+	return bookResolvers(books), nil
+}
+
+func modelID(id uint) gorm.Model {
+	return gorm.Model{ID: id}
+}
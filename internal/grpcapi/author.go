@@ -0,0 +1,99 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+	bookapiv1 "github.com/joseph-gunnarsson/book-api/internal/pb/bookapi/v1"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type authorService struct {
+	bookapiv1.UnimplementedAuthorServiceServer
+}
+
+func (authorService) ListAuthors(ctx context.Context, req *bookapiv1.ListAuthorsRequest) (*bookapiv1.ListAuthorsResponse, error) {
+	authors, err := models.GetAllAuthors(ctx)
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to get authors", err)
+	}
+
+	resp := &bookapiv1.ListAuthorsResponse{Authors: make([]*bookapiv1.Author, len(authors))}
+	for i, author := range authors {
+		resp.Authors[i] = toAuthor(author)
+	}
+	return resp, nil
+}
+
+func (authorService) GetAuthor(ctx context.Context, req *bookapiv1.GetAuthorRequest) (*bookapiv1.Author, error) {
+	if err := requireID(req.Id); err != nil {
+		return nil, err
+	}
+	author, err := models.GetAuthor(ctx, uint(req.Id))
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to get author", err)
+	}
+	return toAuthor(author), nil
+}
+
+func (authorService) CreateAuthor(ctx context.Context, req *bookapiv1.CreateAuthorRequest) (*bookapiv1.Author, error) {
+	author := models.Author{
+		FirstName:   req.FirstName,
+		LastName:    req.LastName,
+		Nationality: req.Nationality,
+		Website:     req.Website,
+	}
+	err := models.CreateAuthor(ctx, &author)
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to create author", err)
+	}
+
+	created, err := models.GetAuthor(ctx, author.ID)
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to get created author", err)
+	}
+	return toAuthor(created), nil
+}
+
+func (authorService) UpdateAuthor(ctx context.Context, req *bookapiv1.UpdateAuthorRequest) (*bookapiv1.Author, error) {
+	if err := requireID(req.Id); err != nil {
+		return nil, err
+	}
+	if _, err := models.GetAuthor(ctx, uint(req.Id)); err != nil {
+		return nil, toStatus(ctx, "Failed to get author", err)
+	}
+
+	author := models.Author{
+		FirstName:   req.FirstName,
+		LastName:    req.LastName,
+		Nationality: req.Nationality,
+		Website:     req.Website,
+	}
+	author.ID = uint(req.Id)
+	err := models.UpdateAuthor(ctx, &author)
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to update author", err)
+	}
+
+	updated, err := models.GetAuthor(ctx, uint(req.Id))
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to get updated author", err)
+	}
+	return toAuthor(updated), nil
+}
+
+func (authorService) DeleteAuthor(ctx context.Context, req *bookapiv1.DeleteAuthorRequest) (*emptypb.Empty, error) {
+	if err := requireID(req.Id); err != nil {
+		return nil, err
+	}
+	author, err := models.GetAuthor(ctx, uint(req.Id))
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to get author", err)
+	}
+
+	err = models.DeleteAuthor(ctx, &author)
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to delete author", err)
+	}
+	return &emptypb.Empty{}, nil
+}
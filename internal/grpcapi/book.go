@@ -0,0 +1,108 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+	bookapiv1 "github.com/joseph-gunnarsson/book-api/internal/pb/bookapi/v1"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type bookService struct {
+	bookapiv1.UnimplementedBookServiceServer
+}
+
+func (bookService) ListBooks(ctx context.Context, req *bookapiv1.ListBooksRequest) (*bookapiv1.ListBooksResponse, error) {
+	books, err := models.GetAllBooks(ctx)
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to get books", err)
+	}
+
+	resp := &bookapiv1.ListBooksResponse{Books: make([]*bookapiv1.Book, len(books))}
+	for i, book := range books {
+		resp.Books[i] = toBook(book)
+	}
+	return resp, nil
+}
+
+func (bookService) GetBook(ctx context.Context, req *bookapiv1.GetBookRequest) (*bookapiv1.Book, error) {
+	if err := requireID(req.Id); err != nil {
+		return nil, err
+	}
+	book, err := models.GetBookById(ctx, int(req.Id))
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to get book", err)
+	}
+	return toBook(book), nil
+}
+
+func (bookService) CreateBook(ctx context.Context, req *bookapiv1.CreateBookRequest) (*bookapiv1.Book, error) {
+	book := models.Book{
+		Title:       req.Title,
+		ISBN:        req.Isbn,
+		Description: req.Description,
+		AuthorID:    int(req.AuthorId),
+		Genre:       genresByID(req.GenreIds),
+	}
+	if req.ReleaseDate != nil {
+		book.ReleaseDate = req.ReleaseDate.AsTime()
+	}
+	err := models.CreateBook(ctx, &book)
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to create book", err)
+	}
+
+	created, err := models.GetBookById(ctx, int(book.ID))
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to get created book", err)
+	}
+	return toBook(created), nil
+}
+
+func (bookService) UpdateBook(ctx context.Context, req *bookapiv1.UpdateBookRequest) (*bookapiv1.Book, error) {
+	if err := requireID(req.Id); err != nil {
+		return nil, err
+	}
+	if _, err := models.GetBookById(ctx, int(req.Id)); err != nil {
+		return nil, toStatus(ctx, "Failed to get book", err)
+	}
+
+	book := models.Book{
+		Title:       req.Title,
+		ISBN:        req.Isbn,
+		Description: req.Description,
+		AuthorID:    int(req.AuthorId),
+	}
+	book.ID = uint(req.Id)
+	if req.ReleaseDate != nil {
+		book.ReleaseDate = req.ReleaseDate.AsTime()
+	}
+	if req.Genres != nil {
+		book.Genre = genresByID(req.Genres.Ids)
+	}
+	err := models.UpdateBook(ctx, &book, nil)
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to update book", err)
+	}
+
+	updated, err := models.GetBookById(ctx, int(req.Id))
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to get updated book", err)
+	}
+	return toBook(updated), nil
+}
+
+func (bookService) DeleteBook(ctx context.Context, req *bookapiv1.DeleteBookRequest) (*emptypb.Empty, error) {
+	if err := requireID(req.Id); err != nil {
+		return nil, err
+	}
+	if _, err := models.GetBookById(ctx, int(req.Id)); err != nil {
+		return nil, toStatus(ctx, "Failed to get book", err)
+	}
+
+	err := models.DeleteBookByID(ctx, uint(req.Id))
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to delete book", err)
+	}
+	return &emptypb.Empty{}, nil
+}
@@ -0,0 +1,60 @@
+package grpcapi
+
+import (
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+	bookapiv1 "github.com/joseph-gunnarsson/book-api/internal/pb/bookapi/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func toBook(book models.Book) *bookapiv1.Book {
+	pb := &bookapiv1.Book{
+		Id:          uint64(book.ID),
+		Title:       book.Title,
+		Isbn:        book.ISBN,
+		ReleaseDate: timestamppb.New(book.ReleaseDate),
+		Description: book.Description,
+		AuthorId:    uint64(book.AuthorID),
+		Genres:      make([]*bookapiv1.Genre, len(book.Genre)),
+		CreateTime:  timestamppb.New(book.CreatedAt),
+		UpdateTime:  timestamppb.New(book.UpdatedAt),
+	}
+	if book.Author.ID != 0 {
+		pb.Author = toAuthor(book.Author)
+	}
+	for i, genre := range book.Genre {
+		pb.Genres[i] = toGenre(genre)
+	}
+	return pb
+}
+
+func toAuthor(author models.Author) *bookapiv1.Author {
+	return &bookapiv1.Author{
+		Id:          uint64(author.ID),
+		FirstName:   author.FirstName,
+		LastName:    author.LastName,
+		Nationality: author.Nationality,
+		Website:     author.Website,
+		CreateTime:  timestamppb.New(author.CreatedAt),
+		UpdateTime:  timestamppb.New(author.UpdatedAt),
+	}
+}
+
+func toGenre(genre models.Genre) *bookapiv1.Genre {
+	return &bookapiv1.Genre{
+		Id:         uint64(genre.ID),
+		Name:       genre.Genre,
+		Slug:       genre.Slug,
+		CreateTime: timestamppb.New(genre.CreatedAt),
+		UpdateTime: timestamppb.New(genre.UpdatedAt),
+	}
+}
+
+// genresByID returns genres carrying only the given IDs, which is what
+// models.CreateBook and models.UpdateBook expect.
+func genresByID(ids []uint64) []models.Genre {
+	genres := make([]models.Genre, len(ids))
+	for i, id := range ids {
+		genres[i].ID = uint(id)
+	}
+	return genres
+}
@@ -0,0 +1,102 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+	bookapiv1 "github.com/joseph-gunnarsson/book-api/internal/pb/bookapi/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type genreService struct {
+	bookapiv1.UnimplementedGenreServiceServer
+}
+
+func (genreService) ListGenres(ctx context.Context, req *bookapiv1.ListGenresRequest) (*bookapiv1.ListGenresResponse, error) {
+	genres, err := models.GetAllGenre(ctx)
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to get genres", err)
+	}
+
+	resp := &bookapiv1.ListGenresResponse{Genres: make([]*bookapiv1.Genre, len(genres))}
+	for i, genre := range genres {
+		resp.Genres[i] = toGenre(genre)
+	}
+	return resp, nil
+}
+
+func (genreService) GetGenre(ctx context.Context, req *bookapiv1.GetGenreRequest) (*bookapiv1.Genre, error) {
+	genre, err := getGenre(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return toGenre(genre), nil
+}
+
+func (genreService) CreateGenre(ctx context.Context, req *bookapiv1.CreateGenreRequest) (*bookapiv1.Genre, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	genre := models.Genre{Genre: req.Name}
+	err := models.CreateGenre(ctx, &genre)
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to create genre", err)
+	}
+
+	created, err := models.GetGenreByName(ctx, req.Name)
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to get created genre", err)
+	}
+	return toGenre(created), nil
+}
+
+// UpdateGenre renames a genre if new_name is set, and otherwise like PUT
+// /v1/genres/{genre} with an empty body only touches the update time.
+func (genreService) UpdateGenre(ctx context.Context, req *bookapiv1.UpdateGenreRequest) (*bookapiv1.Genre, error) {
+	existing, err := getGenre(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	genre := models.Genre{Genre: req.NewName}
+	genre.ID = existing.ID
+	err = models.UpdateGenre(ctx, &genre)
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to update genre", err)
+	}
+
+	updated, err := models.GetGenre(ctx, existing.ID)
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to get updated genre", err)
+	}
+	return toGenre(updated), nil
+}
+
+func (genreService) DeleteGenre(ctx context.Context, req *bookapiv1.DeleteGenreRequest) (*emptypb.Empty, error) {
+	genre, err := getGenre(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = models.DeleteGenre(ctx, &genre)
+	if err != nil {
+		return nil, toStatus(ctx, "Failed to delete genre", err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// getGenre loads the genre key refers to, an ID, slug, former slug or name.
+// Unlike the REST API there are no redirects, so former slugs and names
+// resolve like current slugs.
+func getGenre(ctx context.Context, key string) (models.Genre, error) {
+	if key == "" {
+		return models.Genre{}, status.Error(codes.InvalidArgument, "name is required")
+	}
+	genre, _, err := models.FindGenre(ctx, key)
+	if err != nil {
+		return models.Genre{}, toStatus(ctx, "Failed to get genre", err)
+	}
+	return genre, nil
+}
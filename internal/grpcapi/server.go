@@ -0,0 +1,107 @@
+// Package grpcapi serves the services defined in proto/bookapi/v1 over gRPC.
+// They call the same model functions as the REST handlers in
+// internal/routers, so both APIs read and write the same data with the same
+// rules.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/joseph-gunnarsson/book-api/internal/logging"
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+	bookapiv1 "github.com/joseph-gunnarsson/book-api/internal/pb/bookapi/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// NewServer returns a gRPC server with the book, author and genre services,
+// the standard health service and server reflection registered.
+func NewServer() *grpc.Server {
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(logCalls, recoverPanics))
+	bookapiv1.RegisterBookServiceServer(server, bookService{})
+	bookapiv1.RegisterAuthorServiceServer(server, authorService{})
+	bookapiv1.RegisterGenreServiceServer(server, genreService{})
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	return server
+}
+
+// logCalls logs one line per call with the method, status code and
+// latency, like middleware.AccessLog does for HTTP requests.
+func logCalls(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	logger := logging.FromContext(ctx).With(slog.String("grpc_method", info.FullMethod))
+	ctx = logging.WithContext(ctx, logger)
+
+	resp, err := handler(ctx, req)
+
+	code := status.Code(err)
+	attrs := []any{
+		slog.String("code", code.String()),
+		slog.Duration("latency", time.Since(start)),
+	}
+	level := slog.LevelInfo
+	switch code {
+	case codes.OK, codes.NotFound, codes.InvalidArgument, codes.Canceled:
+	case codes.Internal, codes.Unknown:
+		level = slog.LevelError
+		attrs = append(attrs, slog.Any("error", err))
+	default:
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	logger.Log(ctx, level, "Call", attrs...)
+	return resp, err
+}
+
+// recoverPanics turns a panic in a handler into an Internal error and logs
+// it with the stack trace.
+func recoverPanics(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		rvr := recover()
+		if rvr == nil {
+			return
+		}
+		logging.FromContext(ctx).Error("Handler panicked",
+			slog.String("panic", fmt.Sprint(rvr)),
+			slog.String("stack", string(debug.Stack())),
+		)
+		err = status.Error(codes.Internal, "internal server error")
+	}()
+	return handler(ctx, req)
+}
+
+// toStatus converts an error from the models package into a gRPC status.
+// Validation errors are sent to the client as InvalidArgument; details of
+// unexpected errors are logged rather than sent to the client.
+func toStatus(ctx context.Context, msg string, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return status.Error(codes.NotFound, msg+": not found")
+	case errors.Is(err, models.ErrInvalidContributors),
+		errors.Is(err, models.ErrInvalidSeries),
+		errors.Is(err, models.ErrInvalidPublisher),
+		errors.Is(err, models.ErrInvalidEdition),
+		errors.Is(err, models.ErrInvalidGenreParent):
+		return status.Error(codes.InvalidArgument, msg+": "+err.Error())
+	}
+	logging.FromContext(ctx).Error(msg, "error", err)
+	return status.Error(codes.Internal, msg)
+}
+
+func requireID(id uint64) error {
+	if id == 0 {
+		return status.Error(codes.InvalidArgument, "id is required")
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// TestToStatus checks that model errors are mapped to the gRPC codes
+// clients can act on.
+func TestToStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{gorm.ErrRecordNotFound, codes.NotFound},
+		{fmt.Errorf("%w: first contributor must be an author", models.ErrInvalidContributors), codes.InvalidArgument},
+		{fmt.Errorf("%w: series 5 does not exist", models.ErrInvalidSeries), codes.InvalidArgument},
+		{errors.New("connection refused"), codes.Internal},
+	}
+	for _, tt := range tests {
+		err := toStatus(context.Background(), "Failed to create book", tt.err)
+		if got := status.Code(err); got != tt.want {
+			t.Errorf("toStatus(%q) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
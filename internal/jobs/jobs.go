@@ -0,0 +1,277 @@
+// Package jobs runs catalogue imports in the background. Jobs are stored in
+// the database and claimed by a pool of workers. A claimed job is leased to
+// its worker, which renews the lease while it runs, so jobs of a process that
+// stopped are requeued once their lease expires and picked up by any pool.
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/joseph-gunnarsson/book-api/internal/catalog"
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// pollInterval is how often idle workers look for jobs submitted
+	// without a notification, e.g. by another process.
+	pollInterval = 5 * time.Second
+	// progressInterval limits how often progress is written to the database.
+	progressInterval = time.Second
+	// renewInterval is how often a running job's lease is renewed, often
+	// enough for a few renewals to fail before it expires.
+	renewInterval = models.ImportJobLease / 3
+)
+
+var (
+	mu      sync.Mutex
+	running = map[uint]context.CancelFunc{}
+	notify  chan struct{}
+	stop    context.CancelFunc
+	wg      sync.WaitGroup
+)
+
+// Start requeues jobs whose lease expired and starts the given number of
+// workers.
+func Start(ctx context.Context, workers int) error {
+	if err := models.RequeueExpiredImportJobs(ctx); err != nil {
+		return err
+	}
+
+	ctx, stop = context.WithCancel(context.WithoutCancel(ctx))
+	notify = make(chan struct{}, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go worker(ctx)
+	}
+	return nil
+}
+
+// Stop stops the workers and waits for them to exit. Jobs that are still
+// running are rolled back and requeued, to be restarted by any pool.
+func Stop(ctx context.Context) error {
+	if stop == nil {
+		return nil
+	}
+	stop()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Submit stores a new job and wakes up an idle worker.
+func Submit(ctx context.Context, job *models.ImportJob) error {
+	job.Status = models.ImportJobPending
+	if err := models.CreateImportJob(ctx, job); err != nil {
+		return err
+	}
+
+	select {
+	case notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Cancel cancels a pending or running job. A running job is rolled back, so
+// nothing it imported is kept. A job completes in the transaction of its
+// import, so once the import is committed the job can't be cancelled
+// anymore.
+func Cancel(ctx context.Context, id uint) (models.ImportJob, error) {
+	job, err := models.CancelImportJob(ctx, id)
+	if err != nil {
+		return job, err
+	}
+
+	mu.Lock()
+	if cancel, ok := running[id]; ok {
+		cancel()
+	}
+	mu.Unlock()
+	return job, nil
+}
+
+func worker(ctx context.Context) {
+	defer wg.Done()
+
+	for {
+		job, ok, err := models.ClaimImportJob(ctx)
+		if err != nil {
+			slog.Error("Failed to claim import job", "error", err)
+		}
+		if ok {
+			run(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-notify:
+		case <-time.After(pollInterval):
+			// Pick up jobs of processes that stopped while this one runs.
+			if err := models.RequeueExpiredImportJobs(ctx); err != nil {
+				slog.Error("Failed to requeue expired import jobs", "error", err)
+			}
+		}
+	}
+}
+
+func run(poolCtx context.Context, job models.ImportJob) {
+	ctx, cancel := context.WithCancel(poolCtx)
+	defer cancel()
+
+	logger := slog.Default().With("import_job_id", job.ID)
+	logger.Info("Import job started", "format", job.Format, "dry_run", job.DryRun)
+
+	mu.Lock()
+	running[job.ID] = cancel
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		delete(running, job.ID)
+		mu.Unlock()
+	}()
+
+	// The job's final state must be saved even if ctx was cancelled.
+	saveCtx := context.WithoutCancel(ctx)
+	finish := func(status, message string) {
+		job.Status = status
+		job.Message = message
+		if err := models.FinishImportJob(saveCtx, &job); err != nil {
+			logger.Error("Failed to finish import job", "error", err)
+		}
+	}
+
+	go renew(ctx, job, cancel, logger)
+
+	// A panic, e.g. on a malformed file, fails the job instead of crashing
+	// the server. Otherwise the job would be requeued on restart and crash
+	// it again.
+	defer func() {
+		if p := recover(); p != nil {
+			finish(models.ImportJobFailed, fmt.Sprintf("Import failed unexpectedly: %v", p))
+			logger.Error("Import job panicked", "panic", p, "stack", string(debug.Stack()))
+		}
+	}()
+
+	format, err := catalog.ParseFormat(job.Format)
+	if err != nil {
+		finish(models.ImportJobFailed, err.Error())
+		return
+	}
+
+	records, rowErrors, err := catalog.Read(bytes.NewReader(job.Payload), format)
+	if err != nil {
+		finish(models.ImportJobFailed, "Failed to parse import file: "+err.Error())
+		return
+	}
+
+	total := len(records) + len(rowErrors)
+	lastUpdate := time.Time{}
+	progress := func(report catalog.Report) {
+		if time.Since(lastUpdate) < progressInterval {
+			return
+		}
+		lastUpdate = time.Now()
+
+		ok, err := models.UpdateImportJobProgress(ctx, job, total, report.Created+report.Failed, report.Failed)
+		if err != nil {
+			logger.Error("Failed to update import job progress", "error", err)
+			return
+		}
+		// The job was cancelled, possibly by another process.
+		if !ok {
+			cancel()
+		}
+	}
+
+	complete := func(report catalog.Report) {
+		report.AddErrors(rowErrors)
+		job.Status = models.ImportJobCompleted
+		job.Total = report.Total
+		job.Processed = report.Total
+		job.Failed = report.Failed
+		job.Errors = make([]models.ImportJobError, len(report.Errors))
+		for i, rowErr := range report.Errors {
+			job.Errors[i] = models.ImportJobError(rowErr)
+		}
+	}
+
+	options := catalog.ImportOptions{DryRun: job.DryRun, Progress: progress}
+	if !job.DryRun {
+		// Completing the job together with the import means a concurrent
+		// Cancel either rolls the import back or finds the job completed,
+		// never a cancelled job whose books were saved.
+		options.Finish = func(tx *gorm.DB, report catalog.Report) error {
+			complete(report)
+			return models.FinishImportJobTx(tx, &job)
+		}
+	}
+
+	report, err := catalog.Import(ctx, records, options)
+	switch {
+	case err == nil:
+		if job.DryRun {
+			complete(report)
+			finish(models.ImportJobCompleted, "")
+		}
+		logger.Info("Import job completed", "total", job.Total, "failed", job.Failed)
+	case errors.Is(err, context.Canceled) && poolCtx.Err() != nil:
+		if err := models.RequeueImportJob(saveCtx, job); err != nil {
+			logger.Error("Failed to requeue import job", "error", err)
+		}
+		logger.Info("Import job interrupted by shutdown and requeued")
+	case errors.Is(err, context.Canceled), errors.Is(err, models.ErrImportJobFinished):
+		// Cancel already marked the job as cancelled, or it was requeued
+		// and belongs to another claim now.
+		logger.Info("Import job cancelled")
+	default:
+		finish(models.ImportJobFailed, err.Error())
+		logger.Error("Import job failed", "error", err)
+	}
+}
+
+// renew renews the lease of a running job until ctx is done. If the job is
+// no longer running under this claim, e.g. because it was cancelled by
+// another process or requeued after missed renewals, it is stopped.
+func renew(ctx context.Context, job models.ImportJob, cancel context.CancelFunc, logger *slog.Logger) {
+	ticker := time.NewTicker(renewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ok, err := models.RenewImportJobLease(ctx, job)
+		if err != nil {
+			logger.Error("Failed to renew import job lease", "error", err)
+			continue
+		}
+		if !ok {
+			cancel()
+			return
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/joseph-gunnarsson/book-api/internal/config"
+)
+
+// Deprecation adds Deprecation, Sunset and Link headers to the responses of
+// the routes in policies, which are keyed by route pattern or by method and
+// route pattern. The route is only known once chi has routed the request,
+// so the headers are added just before the response header is written.
+func Deprecation(policies map[string]config.Deprecation) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(policies) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(&deprecationWriter{ResponseWriter: w, r: r, policies: policies}, r)
+		})
+	}
+}
+
+type deprecationWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	policies    map[string]config.Deprecation
+	wroteHeader bool
+}
+
+func (w *deprecationWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.setHeaders()
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *deprecationWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *deprecationWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *deprecationWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *deprecationWriter) setHeaders() {
+	rctx := chi.RouteContext(w.r.Context())
+	if rctx == nil {
+		return
+	}
+	pattern := rctx.RoutePattern()
+	policy, ok := w.policies[w.r.Method+" "+pattern]
+	if !ok {
+		policy, ok = w.policies[pattern]
+	}
+	if !ok {
+		return
+	}
+
+	header := w.Header()
+	if !policy.Deprecation.IsZero() {
+		// RFC 9745 structured field date.
+		header.Set("Deprecation", fmt.Sprintf("@%d", policy.Deprecation.Unix()))
+	}
+	if !policy.Sunset.IsZero() {
+		header.Set("Sunset", policy.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if policy.Link != "" {
+		header.Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"; type="text/html"`, policy.Link))
+	}
+}
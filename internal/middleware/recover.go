@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/joseph-gunnarsson/book-api/internal/logging"
+)
+
+// Recover turns a panic in a handler into a JSON 500 response and logs it
+// with the stack trace. If the handler already started writing the response
+// the status can't be changed, so the connection is only logged about.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			// http.ErrAbortHandler is how handlers deliberately abort a
+			// response; net/http handles it without logging.
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+
+			logging.FromContext(r.Context()).Error("Handler panicked",
+				slog.String("panic", fmt.Sprint(rvr)),
+				slog.String("stack", string(debug.Stack())),
+			)
+			if ww.Status() != 0 {
+				return
+			}
+
+			ww.Header().Set("Content-Type", "application/json")
+			ww.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(ww).Encode(map[string]string{
+				"error":     "Internal server error",
+				"requestID": GetRequestID(r.Context()),
+			})
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
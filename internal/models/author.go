@@ -1,6 +1,10 @@
 package models
 
 import (
+	"context"
+	"errors"
+	"fmt"
+
 	"github.com/joseph-gunnarsson/book-api/internal/database"
 	"gorm.io/gorm"
 )
@@ -11,10 +15,36 @@ type Author struct {
 	LastName    string `json:"lastName" gorm:"size:50;not null"`
 	Nationality string `json:"nationality" gorm:"size:50;"`
 	Website     string `json:"website" gorm:"size:50;"`
+	// Books is only loaded when requested with include=books. It carries
+	// the foreign key constraint of Book.Author.
+	Books []Book `gorm:"foreignKey:AuthorID;constraint:OnDelete:CASCADE;" json:"books,omitempty"`
+}
+
+var (
+	authorFields = map[string]field{
+		"id":          {"id", "ID"},
+		"createdAt":   {"created_at", "CreatedAt"},
+		"updatedAt":   {"updated_at", "UpdatedAt"},
+		"firstName":   {"first_name", "firstName"},
+		"lastName":    {"last_name", "lastName"},
+		"nationality": {"nationality", "nationality"},
+		"website":     {"website", "website"},
+	}
+	authorRelations = map[string]relation{
+		"books": {"Books", "books", ""},
+	}
+)
+
+// ParseAuthorFields parses the fields and include query parameters of
+// author endpoints. By default authors are sent without their books.
+func ParseAuthorFields(fields, include string) (Fields, error) {
+	return parseFields(fields, include, authorFields, authorRelations, nil)
 }
 
-func CreateAuthor(author *Author) error {
-	db := database.DB
+func CreateAuthor(ctx context.Context, author *Author) error {
+	defer InvalidateCache(ctx, CacheAuthors, CacheBooks)
+
+	db := database.DB.WithContext(ctx)
 	result := db.Create(author)
 	if result.Error != nil {
 		return result.Error
@@ -22,8 +52,16 @@ func CreateAuthor(author *Author) error {
 	return nil
 }
 
-func DeleteAuthor(author *Author) error {
-	db := database.DB
+func CreateAuthors(ctx context.Context, authors []Author, atomic bool) ([]error, error) {
+	defer InvalidateCache(ctx, CacheAuthors, CacheBooks)
+
+	return createInBatches(ctx, authors, atomic, nil)
+}
+
+func DeleteAuthor(ctx context.Context, author *Author) error {
+	defer InvalidateCache(ctx, CacheAuthors, CacheBooks)
+
+	db := database.DB.WithContext(ctx)
 	result := db.Delete(author)
 	if result.Error != nil {
 		return result.Error
@@ -31,8 +69,39 @@ func DeleteAuthor(author *Author) error {
 	return nil
 }
 
-func UpdateAuthor(author *Author) error {
-	db := database.DB
+func DeleteAuthorsByID(ctx context.Context, authorIDs []uint, atomic bool) ([]error, error) {
+	defer InvalidateCache(ctx, CacheAuthors, CacheBooks)
+
+	return applyEach(ctx, authorIDs, atomic, func(db *gorm.DB, authorID uint) error {
+		var author Author
+		if err := db.First(&author, authorID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("author with ID %d does not exist", authorID)
+			}
+			return err
+		}
+		return db.Delete(&author).Error
+	})
+}
+
+func UpdateAuthor(ctx context.Context, author *Author) error {
+	defer InvalidateCache(ctx, CacheAuthors, CacheBooks)
+
+	return updateAuthor(database.DB.WithContext(ctx), author)
+}
+
+func UpdateAuthors(ctx context.Context, authors []Author, atomic bool) ([]error, error) {
+	defer InvalidateCache(ctx, CacheAuthors, CacheBooks)
+
+	return applyEach(ctx, authors, atomic, func(db *gorm.DB, author Author) error {
+		if author.ID == 0 {
+			return errMissingID
+		}
+		return updateAuthor(db, &author)
+	})
+}
+
+func updateAuthor(db *gorm.DB, author *Author) error {
 	result := db.Model(&author).Updates(author)
 	if result.Error != nil {
 		return result.Error
@@ -40,8 +109,8 @@ func UpdateAuthor(author *Author) error {
 	return nil
 }
 
-func GetAllAuthors() ([]Author, error) {
-	db := database.DB
+func GetAllAuthors(ctx context.Context) ([]Author, error) {
+	db := database.DB.WithContext(ctx)
 	var authors []Author
 	result := db.Find(&authors)
 
@@ -52,20 +121,50 @@ func GetAllAuthors() ([]Author, error) {
 	return authors, nil
 }
 
-func GetAuthor(id uint) (Author, error) {
-	db := database.DB
+func GetAuthor(ctx context.Context, id uint) (Author, error) {
+	return cached(ctx, fmt.Sprintf("%sid:%d", CacheAuthors, id), func() (Author, error) {
+		db := database.DB.WithContext(ctx)
+		var author Author
+		result := db.First(&author, id)
+
+		if result.Error != nil {
+			return Author{}, result.Error
+		}
+
+		return author, nil
+	})
+}
+
+// GetAllAuthorsWithFields is like GetAllAuthors but loads the columns and
+// relations selected by fields.
+func GetAllAuthorsWithFields(ctx context.Context, fields Fields) ([]Author, error) {
+	db := fields.apply(database.DB.WithContext(ctx))
+	var authors []Author
+	result := db.Find(&authors)
+	if result.Error != nil {
+		return []Author{}, result.Error
+	}
+	return authors, nil
+}
+
+// GetAuthorWithFields is like GetAuthor but loads the columns and relations
+// selected by fields. Only whole authors are cached.
+func GetAuthorWithFields(ctx context.Context, id uint, fields Fields) (Author, error) {
+	if fields.Keys() == nil {
+		return GetAuthor(ctx, id)
+	}
+
+	db := fields.apply(database.DB.WithContext(ctx))
 	var author Author
 	result := db.First(&author, id)
-
 	if result.Error != nil {
 		return Author{}, result.Error
 	}
-
 	return author, nil
 }
 
-func GetAuthorByCondition(condition map[string]interface{}) ([]Author, error) {
-	db := database.DB
+func GetAuthorByCondition(ctx context.Context, condition map[string]interface{}) ([]Author, error) {
+	db := database.DB.WithContext(ctx)
 	var authors []Author
 	result := db.Where(condition).Find(&authors)
 
@@ -75,3 +174,42 @@ func GetAuthorByCondition(condition map[string]interface{}) ([]Author, error) {
 
 	return authors, nil
 }
+
+// AuthorFilter restricts the authors returned by FindAuthors. Zero fields
+// don't restrict anything.
+type AuthorFilter struct {
+	// Name matches authors whose first or last name contains it.
+	Name        string
+	Nationality string
+}
+
+// FindAuthors returns the authors matching filter ordered by ID.
+func FindAuthors(ctx context.Context, filter AuthorFilter, page Page) ([]Author, error) {
+	db := database.DB.WithContext(ctx)
+	if filter.Name != "" {
+		pattern := containsPattern(filter.Name)
+		db = db.Where("first_name LIKE ? OR last_name LIKE ?", pattern, pattern)
+	}
+	if filter.Nationality != "" {
+		db = db.Where("nationality = ?", filter.Nationality)
+	}
+
+	var authors []Author
+	result := page.apply(db.Order("id")).Find(&authors)
+	if result.Error != nil {
+		return []Author{}, result.Error
+	}
+	return authors, nil
+}
+
+// GetAuthorsByIDs returns the authors with the given IDs in no particular
+// order. Unknown IDs are skipped.
+func GetAuthorsByIDs(ctx context.Context, ids []uint) ([]Author, error) {
+	db := database.DB.WithContext(ctx)
+	var authors []Author
+	result := db.Where("id IN ?", ids).Find(&authors)
+	if result.Error != nil {
+		return []Author{}, result.Error
+	}
+	return authors, nil
+}
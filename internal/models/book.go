@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -11,32 +12,138 @@ import (
 
 type Book struct {
 	gorm.Model
-	Title       string    `json:"title" gorm:"size:255;not null;unique;"`
+	// Title isn't unique, since editions of a work usually share it.
+	Title       string    `json:"title" gorm:"size:255;not null;index"`
 	ReleaseDate time.Time `json:"releaseDate" gorm:"not null"`
 	Genre       []Genre   `gorm:"many2many:book_genre;"`
 	Description string    `json:"description" gorm:"size:1000"`
-	ISBN        string    `json:"isbn" gorm:"size:12;not null"`
+	ISBN        string    `json:"isbn" gorm:"size:13;not null"`
 	AuthorID    int       `gorm:"index;not null" json:"authorID"`
 	Author      Author    `gorm:"foreignKey:AuthorID;constraint:OnDelete:CASCADE;" json:"author"`
+	// Contributors lists everyone who worked on the book. AuthorID is the
+	// first of them and is kept for clients that expect a single author.
+	Contributors []BookContributor `gorm:"constraint:OnDelete:CASCADE;" json:"contributors"`
+	PublisherID  *uint             `gorm:"index" json:"publisherID"`
+	Publisher    *Publisher        `gorm:"constraint:OnDelete:SET NULL;" json:"publisher,omitempty"`
+	SeriesID     *uint             `gorm:"index" json:"seriesID"`
+	// SeriesPosition is the reading order within the series. Fractions
+	// place novellas between novels, like 2.5.
+	SeriesPosition *float64 `gorm:"type:decimal(8,2)" json:"seriesPosition"`
+	Series         *Series  `gorm:"constraint:OnDelete:SET NULL;" json:"series,omitempty"`
+	// WorkID is the work the book is an edition of. Books created without
+	// one join the work of another edition with the same title and author,
+	// or get a new work.
+	WorkID *uint  `gorm:"index" json:"workID"`
+	Work   *Work  `json:"work,omitempty"`
+	Format string `gorm:"size:20" json:"format"`
+	// PageCount is unset for formats without pages, like audiobooks.
+	PageCount *int   `json:"pageCount"`
+	Language  string `gorm:"size:35" json:"language"`
+	// Previous and Next are only set on single books.
+	Previous *SeriesNeighbour `gorm:"-" json:"previous,omitempty"`
+	Next     *SeriesNeighbour `gorm:"-" json:"next,omitempty"`
 }
 
-func CreateBook(book *Book) error {
-	db := database.DB
+var (
+	bookFields = map[string]field{
+		"id":             {"id", "ID"},
+		"createdAt":      {"created_at", "CreatedAt"},
+		"updatedAt":      {"updated_at", "UpdatedAt"},
+		"title":          {"title", "title"},
+		"releaseDate":    {"release_date", "releaseDate"},
+		"description":    {"description", "description"},
+		"isbn":           {"isbn", "isbn"},
+		"authorID":       {"author_id", "authorID"},
+		"publisherID":    {"publisher_id", "publisherID"},
+		"seriesID":       {"series_id", "seriesID"},
+		"seriesPosition": {"series_position", "seriesPosition"},
+		"workID":         {"work_id", "workID"},
+		"format":         {"format", "format"},
+		"pageCount":      {"page_count", "pageCount"},
+		"language":       {"language", "language"},
+	}
+	bookRelations = map[string]relation{
+		"author":       {"Author", "author", "author_id"},
+		"genres":       {"Genre", "Genre", ""},
+		"contributors": {"Contributors.Author", "contributors", ""},
+		"publisher":    {"Publisher", "publisher", "publisher_id"},
+		"series":       {"Series", "series", "series_id"},
+		"work":         {"Work", "work", "work_id"},
+	}
+)
+
+// ParseBookFields parses the fields and include query parameters of book
+// endpoints. By default books are sent with their author, genres,
+// contributors, publisher, series and work.
+func ParseBookFields(fields, include string) (Fields, error) {
+	return parseFields(fields, include, bookFields, bookRelations, []string{"Author", "Genre", "Contributors.Author", "Publisher", "Series", "Work"})
+}
+
+// BeforeCreate prepares books for every way they are created: it syncs
+// AuthorID with the contributors, checks that their authors exist, the
+// publisher, the series and the edition fields, and sets the work of books
+// created without one.
+func (b *Book) BeforeCreate(tx *gorm.DB) error {
+	if err := b.syncContributors(); err != nil {
+		return err
+	}
+	db := tx.Session(&gorm.Session{NewDB: true})
+	if err := validateAuthorIDs(db, b.Contributors); err != nil {
+		return err
+	}
+	if err := validatePublisher(db, b); err != nil {
+		return err
+	}
+	if err := validateSeries(db, b, nil); err != nil {
+		return err
+	}
+	if err := validateEdition(db, b); err != nil {
+		return err
+	}
+	if b.WorkID == nil {
+		assigned, _ := tx.Statement.Settings.LoadOrStore(assignedWorksKey, map[workKey]uint{})
+		return findOrCreateWork(db, b, assigned.(map[workKey]uint))
+	}
+	return nil
+}
+
+func CreateBook(ctx context.Context, book *Book) error {
+	defer InvalidateCache(ctx, CacheBooks)
 
-	if err := ValidateGenreIDs(book.Genre); err != nil {
+	db := database.DB.WithContext(ctx)
+
+	if err := ValidateGenreIDs(ctx, book.Genre); err != nil {
 		return err
 	}
 
-	result := db.Omit("Author").Create(book)
+	result := db.Omit("Author", "Publisher", "Series", "Work").Create(book)
 	if result.Error != nil {
 		return result.Error
 	}
 	return nil
 }
 
-func DeleteBookByID(bookID uint) error {
-	db := database.DB
+func CreateBooks(ctx context.Context, books []Book, atomic bool) ([]error, error) {
+	defer InvalidateCache(ctx, CacheBooks)
+
+	return createInBatches(ctx, books, atomic, func(book *Book) error {
+		return ValidateGenreIDs(ctx, book.Genre)
+	}, "Author", "Publisher", "Series", "Work")
+}
+
+func DeleteBookByID(ctx context.Context, bookID uint) error {
+	defer InvalidateCache(ctx, CacheBooks)
+
+	return deleteBookByID(database.DB.WithContext(ctx), bookID)
+}
 
+func DeleteBooksByID(ctx context.Context, bookIDs []uint, atomic bool) ([]error, error) {
+	defer InvalidateCache(ctx, CacheBooks)
+
+	return applyEach(ctx, bookIDs, atomic, deleteBookByID)
+}
+
+func deleteBookByID(db *gorm.DB, bookID uint) error {
 	var existingBook Book
 	if err := db.First(&existingBook, bookID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -52,8 +159,8 @@ func DeleteBookByID(bookID uint) error {
 	return nil
 }
 
-func ValidateGenreIDs(genres []Genre) error {
-	db := database.DB
+func ValidateGenreIDs(ctx context.Context, genres []Genre) error {
+	db := database.DB.WithContext(ctx)
 
 	for _, genre := range genres {
 		var existingGenre Genre
@@ -64,56 +171,370 @@ func ValidateGenreIDs(genres []Genre) error {
 	return nil
 }
 
-func UpdateBook(book *Book) error {
-	db := database.DB
+// UpdateBook updates the non-empty fields of a book. keys are the JSON keys
+// sent by the client: a nullable field whose key is in keys is cleared when
+// nil, and clearing the series clears the series position too.
+func UpdateBook(ctx context.Context, book *Book, keys map[string]bool) error {
+	defer InvalidateCache(ctx, CacheBooks)
 
-	if err := ValidateGenreIDs(book.Genre); err != nil {
-		return err
+	return updateBook(database.DB.WithContext(ctx), book, keys)
+}
+
+// UpdateBooks is like UpdateBook for several books, with keys[i] holding
+// the JSON keys of books[i].
+func UpdateBooks(ctx context.Context, books []Book, keys []map[string]bool, atomic bool) ([]error, error) {
+	defer InvalidateCache(ctx, CacheBooks)
+
+	indexes := make([]int, len(books))
+	for i := range indexes {
+		indexes[i] = i
 	}
+	return applyEach(ctx, indexes, atomic, func(db *gorm.DB, i int) error {
+		book := books[i]
+		if book.ID == 0 {
+			return errMissingID
+		}
+		return updateBook(db, &book, keys[i])
+	})
+}
 
-	err := db.Model(&book).Association("Genre").Replace(book.Genre)
-	if err != nil {
+// updateBook updates a book in a transaction, so that a failed update
+// leaves its genres and contributors as they were.
+func updateBook(db *gorm.DB, book *Book, keys map[string]bool) error {
+	if err := validateEdition(db, book); err != nil {
 		return err
 	}
+	if err := validatePublisher(db, book); err != nil {
+		return err
+	}
+	if err := validateSeries(db, book, keys); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// A nil genre list means the client didn't send one, so keep the
+		// existing genres instead of clearing them.
+		if book.Genre != nil {
+			if err := ValidateGenreIDs(tx.Statement.Context, book.Genre); err != nil {
+				return err
+			}
+
+			err := tx.Model(&book).Association("Genre").Replace(book.Genre)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Likewise for contributors, which also set the AuthorID. A new
+		// AuthorID without contributors replaces the book's first author.
+		switch {
+		case book.Contributors != nil:
+			if err := replaceContributors(tx, book, book.Contributors); err != nil {
+				return err
+			}
+			book.AuthorID = int(book.Contributors[0].AuthorID)
+		case book.AuthorID != 0:
+			if err := replaceFirstAuthor(tx, book); err != nil {
+				return err
+			}
+		}
+
+		result := tx.Model(&book).Omit("Contributors", "Publisher", "Series", "Work").Updates(book)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		// Updates skips nil fields, so nulls are written separately.
+		nulls := map[string]interface{}{}
+		if keys["publisherID"] && book.PublisherID == nil {
+			nulls["publisher_id"] = nil
+		}
+		if keys["seriesID"] && book.SeriesID == nil {
+			nulls["series_id"] = nil
+			nulls["series_position"] = nil
+		}
+		if keys["seriesPosition"] && book.SeriesPosition == nil {
+			nulls["series_position"] = nil
+		}
+		if keys["pageCount"] && book.PageCount == nil {
+			nulls["page_count"] = nil
+		}
+		if len(nulls) > 0 {
+			return tx.Model(&Book{}).Where("id = ?", book.ID).Updates(nulls).Error
+		}
+		return nil
+	})
+}
 
-	result := db.Model(&book).Updates(book)
+func GetAllBooks(ctx context.Context) ([]Book, error) {
+	return cached(ctx, CacheBooks+"all", func() ([]Book, error) {
+		db := database.DB.WithContext(ctx)
+		var books []Book
+		result := db.Preload("Author").Preload("Genre").Preload("Contributors.Author").Preload("Publisher").Preload("Series").Preload("Work").Find(&books)
+
+		if result.Error != nil {
+			return []Book{}, result.Error
+		}
+		return books, nil
+	})
+}
+
+// FindBooksInBatches calls fn with every book, loading BulkBatchSize books
+// at a time.
+func FindBooksInBatches(ctx context.Context, fn func([]Book) error) error {
+	db := database.DB.WithContext(ctx)
+	var books []Book
+	result := db.Preload("Author").Preload("Genre").FindInBatches(&books, BulkBatchSize, func(tx *gorm.DB, batch int) error {
+		return fn(books)
+	})
+	return result.Error
+}
+
+func GetBookById(ctx context.Context, id int) (Book, error) {
+	return cached(ctx, fmt.Sprintf("%sid:%d", CacheBooks, id), func() (Book, error) {
+		db := database.DB.WithContext(ctx)
+		var book Book
+		result := db.Preload("Author").Preload("Genre").Preload("Contributors.Author").Preload("Publisher").Preload("Series").Preload("Work").First(&book, id)
+
+		if result.Error != nil {
+			return Book{}, result.Error
+		}
+		if err := loadSeriesNeighbours(db, &book); err != nil {
+			return Book{}, err
+		}
+
+		return book, nil
+	})
+}
+
+// GetBookWithFields is like GetBookById but loads the columns and relations
+// selected by fields. Only whole books are cached.
+func GetBookWithFields(ctx context.Context, id int, fields Fields) (Book, error) {
+	if fields.Keys() == nil {
+		return GetBookById(ctx, id)
+	}
+
+	db := fields.apply(database.DB.WithContext(ctx))
+	var book Book
+	result := db.First(&book, id)
 	if result.Error != nil {
-		return result.Error
+		return Book{}, result.Error
 	}
-	return nil
+	return book, nil
 }
 
-func GetAllBooks() ([]Book, error) {
-	db := database.DB
+func GetBookByCondition(ctx context.Context, condition map[string]interface{}) ([]Book, error) {
+	db := database.DB.WithContext(ctx)
 	var books []Book
-	result := db.Preload("Author").Preload("Genre").Find(&books)
+	result := db.Preload("Author").Preload("Genre").Preload("Contributors.Author").Preload("Publisher").Preload("Series").Preload("Work").Where(condition).Find(&books)
 
 	if result.Error != nil {
 		return []Book{}, result.Error
 	}
+
 	return books, nil
 }
 
-func GetBookById(id int) (Book, error) {
-	db := database.DB
-	var book Book
-	result := db.Preload("Author").Preload("Genre").First(&book, id)
+// BookFilter restricts the books returned by FindBooks. Zero fields don't
+// restrict anything.
+type BookFilter struct {
+	// Title matches books whose title contains it.
+	Title    string
+	ISBN     string
+	AuthorID uint
+	// Genre matches books having the genre with this name, or any of its
+	// subgenres if IncludeSubgenres is set.
+	Genre string
+	// GenreID is like Genre but matches the genre with this ID.
+	GenreID          uint
+	IncludeSubgenres bool
+	ReleasedAfter    *time.Time
+	ReleasedBefore   *time.Time
+	// PublisherID matches books of the publisher or any of its imprints.
+	PublisherID uint
+	SeriesID    uint
+	WorkID      uint
+	Format      string
+	Language    string
+}
+
+// bookSortColumns maps the fields books can be sorted by to their columns.
+var bookSortColumns = map[string]string{
+	"id":             "id",
+	"title":          "title",
+	"releaseDate":    "release_date",
+	"createdAt":      "created_at",
+	"seriesPosition": "series_position",
+}
+
+// ParseBookSort parses a sort parameter for books, like "title" or
+// "-releaseDate".
+func ParseBookSort(value string) (Sort, error) {
+	return parseSort(value, bookSortColumns)
+}
+
+// FindBooks returns the books matching filter ordered by sort, then by ID.
+// Authors and genres aren't loaded.
+func FindBooks(ctx context.Context, filter BookFilter, sort Sort, page Page) ([]Book, error) {
+	return findBooks(database.DB.WithContext(ctx), filter, sort, page)
+}
+
+// FindBooksWithFields is like FindBooks but loads the columns and relations
+// selected by fields.
+func FindBooksWithFields(ctx context.Context, filter BookFilter, sort Sort, page Page, fields Fields) ([]Book, error) {
+	return findBooks(fields.apply(database.DB.WithContext(ctx)), filter, sort, page)
+}
 
+func findBooks(db *gorm.DB, filter BookFilter, sort Sort, page Page) ([]Book, error) {
+	if filter.Title != "" {
+		db = db.Where("title LIKE ?", containsPattern(filter.Title))
+	}
+	if filter.ISBN != "" {
+		db = db.Where("isbn = ?", filter.ISBN)
+	}
+	if filter.AuthorID != 0 {
+		db = db.Where("author_id = ?", filter.AuthorID)
+	}
+	if filter.Genre != "" || filter.GenreID != 0 {
+		genreIDs, err := filterGenreIDs(database.DB.WithContext(db.Statement.Context), filter)
+		if err != nil {
+			return []Book{}, err
+		}
+		db = db.Where("id IN (?)", database.DB.Table("book_genre").
+			Select("book_id").
+			Where("genre_id IN ?", genreIDs))
+	}
+	if filter.ReleasedAfter != nil {
+		db = db.Where("release_date >= ?", *filter.ReleasedAfter)
+	}
+	if filter.ReleasedBefore != nil {
+		db = db.Where("release_date < ?", *filter.ReleasedBefore)
+	}
+	if filter.SeriesID != 0 {
+		db = db.Where("series_id = ?", filter.SeriesID)
+	}
+	if filter.WorkID != 0 {
+		db = db.Where("work_id = ?", filter.WorkID)
+	}
+	if filter.Format != "" {
+		db = db.Where("format = ?", filter.Format)
+	}
+	if filter.Language != "" {
+		db = db.Where("language = ?", filter.Language)
+	}
+	if filter.PublisherID != 0 {
+		publisherIDs, err := descendantIDs(database.DB.WithContext(db.Statement.Context), "publishers", filter.PublisherID)
+		if err != nil {
+			return []Book{}, err
+		}
+		db = db.Where("publisher_id IN ?", publisherIDs)
+	}
+
+	var books []Book
+	result := page.apply(sort.apply(db).Order("id")).Find(&books)
 	if result.Error != nil {
-		return Book{}, result.Error
+		return []Book{}, result.Error
 	}
+	return books, nil
+}
 
-	return book, nil
+// filterGenreIDs returns the IDs of the genres matching the genre fields of
+// filter, including their subgenres if requested.
+func filterGenreIDs(db *gorm.DB, filter BookFilter) ([]uint, error) {
+	query := db.Model(&Genre{})
+	if filter.Genre != "" {
+		query = query.Where("genre = ?", filter.Genre)
+	}
+	if filter.GenreID != 0 {
+		query = query.Where("id = ?", filter.GenreID)
+	}
+	var genreIDs []uint
+	if err := query.Pluck("id", &genreIDs).Error; err != nil {
+		return nil, err
+	}
+	if filter.IncludeSubgenres && len(genreIDs) > 0 {
+		return descendantIDs(db, "genres", genreIDs[0])
+	}
+	return genreIDs, nil
 }
 
-func GetBookByCondition(condition map[string]interface{}) ([]Book, error) {
-	db := database.DB
+// AddBookGenre gives a book a genre. Adding a genre the book already has
+// does nothing.
+func AddBookGenre(ctx context.Context, bookID, genreID uint) error {
+	defer InvalidateCache(ctx, CacheBooks)
+
+	book, genre, err := findBookAndGenre(ctx, bookID, genreID)
+	if err != nil {
+		return err
+	}
+	return database.DB.WithContext(ctx).Model(&book).Association("Genre").Append(&genre)
+}
+
+// RemoveBookGenre takes a genre away from a book. Removing a genre the book
+// doesn't have does nothing.
+func RemoveBookGenre(ctx context.Context, bookID, genreID uint) error {
+	defer InvalidateCache(ctx, CacheBooks)
+
+	book, genre, err := findBookAndGenre(ctx, bookID, genreID)
+	if err != nil {
+		return err
+	}
+	return database.DB.WithContext(ctx).Model(&book).Association("Genre").Delete(&genre)
+}
+
+// findBookAndGenre loads a book and a genre, returning
+// gorm.ErrRecordNotFound if either doesn't exist.
+func findBookAndGenre(ctx context.Context, bookID, genreID uint) (Book, Genre, error) {
+	db := database.DB.WithContext(ctx)
+	var book Book
+	if err := db.First(&book, bookID).Error; err != nil {
+		return Book{}, Genre{}, err
+	}
+	var genre Genre
+	if err := db.First(&genre, genreID).Error; err != nil {
+		return Book{}, Genre{}, err
+	}
+	return book, genre, nil
+}
+
+// GetBooksByAuthorIDs returns the books of the given authors, keyed by
+// author ID. Authors and genres aren't loaded.
+func GetBooksByAuthorIDs(ctx context.Context, authorIDs []uint) (map[uint][]Book, error) {
+	db := database.DB.WithContext(ctx)
 	var books []Book
-	result := db.Preload("Author").Preload("Genre").Where(condition).Find(&books)
+	result := db.Where("author_id IN ?", authorIDs).Order("id").Find(&books)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	byAuthor := make(map[uint][]Book)
+	for _, book := range books {
+		byAuthor[uint(book.AuthorID)] = append(byAuthor[uint(book.AuthorID)], book)
+	}
+	return byAuthor, nil
+}
 
+// GetBooksByGenreIDs returns the books having the given genres, keyed by
+// genre ID. Authors and genres aren't loaded.
+func GetBooksByGenreIDs(ctx context.Context, genreIDs []uint) (map[uint][]Book, error) {
+	db := database.DB.WithContext(ctx)
+	var rows []struct {
+		Book
+		GenreID uint
+	}
+	result := db.Model(&Book{}).
+		Select("books.*, book_genre.genre_id").
+		Joins("JOIN book_genre ON book_genre.book_id = books.id").
+		Where("book_genre.genre_id IN ?", genreIDs).
+		Order("books.id").
+		Find(&rows)
 	if result.Error != nil {
-		return []Book{}, result.Error
+		return nil, result.Error
 	}
 
-	return books, nil
+	byGenre := make(map[uint][]Book)
+	for _, row := range rows {
+		byGenre[row.GenreID] = append(byGenre[row.GenreID], row.Book)
+	}
+	return byGenre, nil
 }
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestBookPublisherMustExist checks that books can't be created with or
+// moved to a publisher that doesn't exist.
+func TestBookPublisherMustExist(t *testing.T) {
+	db := setupDB(t)
+	ctx := context.Background()
+	author := createAuthor(t, db)
+	missing := uint(99)
+
+	book := Book{Title: "The Lathe of Heaven", ISBN: "9780060512750", AuthorID: int(author.ID), ReleaseDate: time.Date(1971, 1, 1, 0, 0, 0, 0, time.UTC), PublisherID: &missing}
+	if err := CreateBook(ctx, &book); !errors.Is(err, ErrInvalidPublisher) {
+		t.Fatalf("CreateBook with a missing publisher: got %v, want ErrInvalidPublisher", err)
+	}
+
+	book.PublisherID = nil
+	if err := CreateBook(ctx, &book); err != nil {
+		t.Fatal(err)
+	}
+
+	update := Book{PublisherID: &missing}
+	update.ID = book.ID
+	if err := UpdateBook(ctx, &update, map[string]bool{"publisherID": true}); !errors.Is(err, ErrInvalidPublisher) {
+		t.Fatalf("UpdateBook with a missing publisher: got %v, want ErrInvalidPublisher", err)
+	}
+}
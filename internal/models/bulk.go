@@ -0,0 +1,106 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/joseph-gunnarsson/book-api/internal/database"
+	"gorm.io/gorm"
+)
+
+// BulkBatchSize is the number of rows inserted per statement by the bulk
+// create functions.
+const BulkBatchSize = 100
+
+// ErrBulkAborted is returned by the bulk functions in atomic mode when an item
+// failed and the whole operation was rolled back.
+var ErrBulkAborted = errors.New("bulk operation aborted, no changes were saved")
+
+var errMissingID = errors.New("missing ID")
+
+// createInBatches inserts items with CreateInBatches. The returned slice holds
+// the error for each item, if any. In atomic mode a single failure rolls back
+// every insert; otherwise failed batches are retried one item at a time so
+// that the valid items are still saved.
+func createInBatches[T any](ctx context.Context, items []T, atomic bool, validate func(*T) error, omit ...string) ([]error, error) {
+	db := database.DB.WithContext(ctx)
+	errs := make([]error, len(items))
+
+	var pending []int
+	for i := range items {
+		if validate != nil {
+			if err := validate(&items[i]); err != nil {
+				errs[i] = err
+				continue
+			}
+		}
+		pending = append(pending, i)
+	}
+
+	if atomic {
+		if len(pending) != len(items) {
+			return errs, ErrBulkAborted
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return tx.Omit(omit...).CreateInBatches(items, BulkBatchSize).Error
+		})
+		if err != nil {
+			return errs, fmt.Errorf("%w: %v", ErrBulkAborted, err)
+		}
+		return errs, nil
+	}
+
+	for start := 0; start < len(pending); start += BulkBatchSize {
+		end := start + BulkBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		indexes := pending[start:end]
+
+		batch := make([]T, len(indexes))
+		for j, i := range indexes {
+			batch[j] = items[i]
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return tx.Omit(omit...).Create(&batch).Error
+		})
+		if err == nil {
+			for j, i := range indexes {
+				items[i] = batch[j]
+			}
+			continue
+		}
+
+		for _, i := range indexes {
+			errs[i] = db.Omit(omit...).Create(&items[i]).Error
+		}
+	}
+	return errs, nil
+}
+
+// applyEach calls fn for every item. In atomic mode all calls share a single
+// transaction which is rolled back on the first failure.
+func applyEach[T any](ctx context.Context, items []T, atomic bool, fn func(*gorm.DB, T) error) ([]error, error) {
+	db := database.DB.WithContext(ctx)
+	errs := make([]error, len(items))
+
+	if !atomic {
+		for i, item := range items {
+			errs[i] = fn(db, item)
+		}
+		return errs, nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i, item := range items {
+			if err := fn(tx, item); err != nil {
+				errs[i] = err
+				return ErrBulkAborted
+			}
+		}
+		return nil
+	})
+	return errs, err
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/joseph-gunnarsson/book-api/internal/cache"
+	"github.com/joseph-gunnarsson/book-api/internal/logging"
+)
+
+// Key prefixes of cached query results. Books embed their author and
+// genres, so changes to authors or genres invalidate books as well.
+const (
+	CacheBooks   = "books:"
+	CacheAuthors = "authors:"
+	CacheGenres  = "genres:"
+)
+
+var (
+	queryCache cache.Cache
+	cacheTTL   time.Duration
+	// cacheGeneration is incremented by every invalidation. A result loaded
+	// while an invalidation happened may predate the change and isn't
+	// stored.
+	cacheGeneration atomic.Uint64
+)
+
+// SetCache caches the results of the read functions in c for ttl. A nil
+// cache disables caching.
+func SetCache(c cache.Cache, ttl time.Duration) {
+	queryCache = c
+	cacheTTL = ttl
+}
+
+// cached returns the value stored under key, or calls load and stores its
+// result. Cache errors are logged and fall back to load, so a broken cache
+// only costs performance.
+func cached[T any](ctx context.Context, key string, load func() (T, error)) (T, error) {
+	if queryCache == nil {
+		return load()
+	}
+	logger := logging.FromContext(ctx)
+
+	data, ok, err := queryCache.Get(ctx, key)
+	if err != nil {
+		logger.Warn("Failed to read from cache", "key", key, "error", err)
+	}
+	if ok {
+		var value T
+		err = json.Unmarshal(data, &value)
+		if err == nil {
+			return value, nil
+		}
+		logger.Warn("Failed to decode cached value", "key", key, "error", err)
+	}
+
+	generation := cacheGeneration.Load()
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+	if cacheGeneration.Load() != generation {
+		return value, nil
+	}
+	data, err = json.Marshal(value)
+	if err == nil {
+		err = queryCache.Set(ctx, key, data, cacheTTL)
+	}
+	if err != nil {
+		logger.Warn("Failed to write to cache", "key", key, "error", err)
+	}
+	return value, nil
+}
+
+// InvalidateCache drops the cached results under the given prefixes. The
+// write functions of this package call it themselves; it is only needed
+// after writing to the database directly.
+func InvalidateCache(ctx context.Context, prefixes ...string) {
+	if queryCache == nil {
+		return
+	}
+	cacheGeneration.Add(1)
+	for _, prefix := range prefixes {
+		if err := queryCache.DeletePrefix(ctx, prefix); err != nil {
+			logging.FromContext(ctx).Error("Failed to invalidate cache", "prefix", prefix, "error", err)
+		}
+	}
+}
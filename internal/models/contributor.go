@@ -0,0 +1,211 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/joseph-gunnarsson/book-api/internal/database"
+	"gorm.io/gorm"
+)
+
+// Contributor roles.
+const (
+	RoleAuthor      = "author"
+	RoleCoAuthor    = "co-author"
+	RoleEditor      = "editor"
+	RoleTranslator  = "translator"
+	RoleIllustrator = "illustrator"
+)
+
+// ErrInvalidContributors is returned when contributors have an unknown
+// role or author, or are empty.
+var ErrInvalidContributors = errors.New("invalid contributors")
+
+var contributorRoles = map[string]bool{
+	RoleAuthor:      true,
+	RoleCoAuthor:    true,
+	RoleEditor:      true,
+	RoleTranslator:  true,
+	RoleIllustrator: true,
+}
+
+// BookContributor links an author to a book in a role. An author can have
+// several roles on the same book, like author and illustrator. Contributors
+// are listed in Position order.
+type BookContributor struct {
+	BookID   uint   `gorm:"primaryKey" json:"-"`
+	AuthorID uint   `gorm:"primaryKey" json:"authorID"`
+	Role     string `gorm:"primaryKey;size:20" json:"role"`
+	Position int    `gorm:"not null" json:"position"`
+	Author   Author `gorm:"constraint:OnDelete:CASCADE;" json:"author"`
+}
+
+// syncContributors keeps Book.AuthorID and the contributors of a new book
+// in sync: a book created with only an AuthorID gets that author as its
+// contributor, and a book created with contributors gets the first one as
+// its AuthorID, replacing any AuthorID that was sent, as updateBook does.
+func (b *Book) syncContributors() error {
+	if len(b.Contributors) == 0 {
+		if b.AuthorID != 0 {
+			b.Contributors = []BookContributor{{AuthorID: uint(b.AuthorID), Role: RoleAuthor}}
+		}
+		return nil
+	}
+	if err := validateContributors(b.Contributors); err != nil {
+		return err
+	}
+	setPositions(b.Contributors)
+	b.AuthorID = int(b.Contributors[0].AuthorID)
+	return nil
+}
+
+// AfterFind orders preloaded contributors, which Preload loads in no
+// particular order.
+func (b *Book) AfterFind(tx *gorm.DB) error {
+	sort.SliceStable(b.Contributors, func(i, j int) bool {
+		return b.Contributors[i].Position < b.Contributors[j].Position
+	})
+	return nil
+}
+
+// GetBookContributors returns the contributors of a book in order, with
+// their authors. It returns gorm.ErrRecordNotFound if the book doesn't
+// exist.
+func GetBookContributors(ctx context.Context, bookID uint) ([]BookContributor, error) {
+	db := database.DB.WithContext(ctx)
+	if err := db.Select("id").First(&Book{}, bookID).Error; err != nil {
+		return nil, err
+	}
+
+	var contributors []BookContributor
+	result := db.Preload("Author").Where("book_id = ?", bookID).Order("position").Find(&contributors)
+	if result.Error != nil {
+		return []BookContributor{}, result.Error
+	}
+	return contributors, nil
+}
+
+// ReplaceBookContributors replaces the contributors of a book with the
+// given ones, in the given order. The first contributor becomes the book's
+// AuthorID.
+func ReplaceBookContributors(ctx context.Context, bookID uint, contributors []BookContributor) error {
+	defer InvalidateCache(ctx, CacheBooks)
+
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var book Book
+		if err := tx.Select("id").First(&book, bookID).Error; err != nil {
+			return err
+		}
+		return replaceContributors(tx, &book, contributors)
+	})
+}
+
+func replaceContributors(tx *gorm.DB, book *Book, contributors []BookContributor) error {
+	if len(contributors) == 0 {
+		return fmt.Errorf("%w: a book needs at least one contributor", ErrInvalidContributors)
+	}
+	if err := validateContributors(contributors); err != nil {
+		return err
+	}
+	if err := validateAuthorIDs(tx, contributors); err != nil {
+		return err
+	}
+	setPositions(contributors)
+	for i := range contributors {
+		contributors[i].BookID = book.ID
+	}
+
+	if err := tx.Where("book_id = ?", book.ID).Delete(&BookContributor{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Omit("Author").Create(&contributors).Error; err != nil {
+		return err
+	}
+	return tx.Model(&Book{}).Where("id = ?", book.ID).Update("author_id", contributors[0].AuthorID).Error
+}
+
+// replaceFirstAuthor makes book.AuthorID the first contributor with the
+// author role, or the first contributor if there is none, and moves it to
+// the front so that it stays the book's AuthorID. The new author is dropped
+// from the other author entries, so it isn't listed twice.
+func replaceFirstAuthor(tx *gorm.DB, book *Book) error {
+	var contributors []BookContributor
+	if err := tx.Where("book_id = ?", book.ID).Order("position").Find(&contributors).Error; err != nil {
+		return err
+	}
+	authorID := uint(book.AuthorID)
+	if len(contributors) > 0 && contributors[0].AuthorID == authorID {
+		return nil
+	}
+
+	first := 0
+	for i, c := range contributors {
+		if c.Role == RoleAuthor {
+			first = i
+			break
+		}
+	}
+	replaced := []BookContributor{{AuthorID: authorID, Role: RoleAuthor}}
+	if len(contributors) > 0 {
+		replaced[0].Role = contributors[first].Role
+	}
+	for i, c := range contributors {
+		if i == first || (c.AuthorID == authorID && c.Role == replaced[0].Role) {
+			continue
+		}
+		replaced = append(replaced, c)
+	}
+	return replaceContributors(tx, book, replaced)
+}
+
+// validateContributors checks the roles of contributors and that no author
+// is listed twice in the same role.
+func validateContributors(contributors []BookContributor) error {
+	type authorRole struct {
+		authorID uint
+		role     string
+	}
+	seen := make(map[authorRole]bool, len(contributors))
+	for _, c := range contributors {
+		if !contributorRoles[c.Role] {
+			return fmt.Errorf("%w: unknown role %q", ErrInvalidContributors, c.Role)
+		}
+		key := authorRole{c.AuthorID, c.Role}
+		if seen[key] {
+			return fmt.Errorf("%w: author %d is listed twice as %s", ErrInvalidContributors, c.AuthorID, c.Role)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+func validateAuthorIDs(tx *gorm.DB, contributors []BookContributor) error {
+	for _, c := range contributors {
+		if err := tx.Select("id").First(&Author{}, c.AuthorID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: author with ID %d doesn't exist", ErrInvalidContributors, c.AuthorID)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func setPositions(contributors []BookContributor) {
+	for i := range contributors {
+		contributors[i].Position = i
+	}
+}
+
+// BackfillContributors gives every book without contributors its AuthorID
+// as author. It is run after AutoMigrate so that books created before
+// contributors existed keep their author.
+func BackfillContributors(ctx context.Context) error {
+	db := database.DB.WithContext(ctx)
+	result := db.Exec(`INSERT INTO book_contributors (book_id, author_id, role, position)
+		SELECT books.id, books.author_id, ?, 0 FROM books
+		WHERE NOT EXISTS (SELECT 1 FROM book_contributors WHERE book_contributors.book_id = books.id)`, RoleAuthor)
+	return result.Error
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// field is a field that can be requested with the fields query parameter.
+type field struct {
+	column string
+	// key is the field's key in JSON responses.
+	key string
+}
+
+// relation is a relation that can be embedded with the include query
+// parameter.
+type relation struct {
+	// name is the struct field passed to Preload.
+	name string
+	key  string
+	// foreignKey is the column the preload needs, if any.
+	foreignKey string
+}
+
+// Fields selects the columns loaded for a model and the relations embedded
+// in it, as requested with the fields and include query parameters.
+type Fields struct {
+	columns  []string
+	preloads []string
+	keys     []string
+}
+
+// Keys returns the JSON keys responses should be limited to, or nil if the
+// whole model should be sent.
+func (f Fields) Keys() []string {
+	return f.keys
+}
+
+func (f Fields) apply(db *gorm.DB) *gorm.DB {
+	if len(f.columns) > 0 {
+		db = db.Select(f.columns)
+	}
+	for _, preload := range f.preloads {
+		db = db.Preload(preload)
+	}
+	return db
+}
+
+// parseFields parses comma-separated field and relation names. Without
+// either, the whole model is loaded with the default relations. Otherwise
+// only the requested fields, or all fields if none were requested, and the
+// requested relations are loaded. The ID is always included.
+func parseFields(fieldList, includeList string, fields map[string]field, relations map[string]relation, defaults []string) (Fields, error) {
+	if fieldList == "" && includeList == "" {
+		return Fields{preloads: defaults}, nil
+	}
+
+	var f Fields
+	add := func(values *[]string, value string) {
+		if !slices.Contains(*values, value) {
+			*values = append(*values, value)
+		}
+	}
+	if fieldList == "" {
+		for _, fd := range fields {
+			add(&f.keys, fd.key)
+		}
+	} else {
+		add(&f.columns, fields["id"].column)
+		add(&f.keys, fields["id"].key)
+		for _, name := range strings.Split(fieldList, ",") {
+			fd, ok := fields[strings.TrimSpace(name)]
+			if !ok {
+				return Fields{}, fmt.Errorf("unknown field %q", name)
+			}
+			add(&f.columns, fd.column)
+			add(&f.keys, fd.key)
+		}
+	}
+
+	if includeList != "" {
+		for _, name := range strings.Split(includeList, ",") {
+			rel, ok := relations[strings.TrimSpace(name)]
+			if !ok {
+				return Fields{}, fmt.Errorf("unknown relation %q", name)
+			}
+			add(&f.preloads, rel.name)
+			add(&f.keys, rel.key)
+			if rel.foreignKey != "" && len(f.columns) > 0 {
+				add(&f.columns, rel.foreignKey)
+			}
+		}
+	}
+	return f, nil
+}
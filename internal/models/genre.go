@@ -1,18 +1,41 @@
 package models
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
 	"github.com/joseph-gunnarsson/book-api/internal/database"
 	"gorm.io/gorm"
 )
 
+// ErrInvalidGenreParent is returned when a genre's parent doesn't exist or
+// would make the genre a subgenre of itself.
+var ErrInvalidGenreParent = errors.New("invalid parent genre")
+
 type Genre struct {
 	gorm.Model
 	Genre string `json:"genre" gorm:"size:255;not null;unique;"`
+	// Slug identifies the genre in URLs. It is derived from the name and
+	// changes with it; former slugs are kept as GenreAliases.
+	Slug string `json:"slug" gorm:"size:255;uniqueIndex"`
+	// ParentID makes the genre a subgenre, like Urban Fantasy of Fantasy.
+	ParentID *uint `json:"parentID" gorm:"index"`
+	// Children is only set in genre trees. It carries the foreign key
+	// constraint of ParentID.
+	Children []Genre `json:"children,omitempty" gorm:"foreignKey:ParentID;constraint:OnDelete:SET NULL;"`
 }
 
-func CreateGenre(genre *Genre) error {
-	db := database.DB
-	result := db.Create(genre)
+func CreateGenre(ctx context.Context, genre *Genre) error {
+	defer InvalidateCache(ctx, CacheGenres, CacheBooks)
+
+	db := database.DB.WithContext(ctx)
+	if err := validateGenreParent(db, genre); err != nil {
+		return err
+	}
+
+	result := db.Omit("Children").Create(genre)
 
 	if result.Error != nil {
 		return result.Error
@@ -21,20 +44,86 @@ func CreateGenre(genre *Genre) error {
 	return nil
 }
 
-func DeleteGenre(genre *Genre) error {
-	db := database.DB
-	result := db.Delete(genre)
+func CreateGenres(ctx context.Context, genres []Genre, atomic bool) ([]error, error) {
+	defer InvalidateCache(ctx, CacheGenres, CacheBooks)
 
-	if result.Error != nil {
-		return result.Error
+	db := database.DB.WithContext(ctx)
+	return createInBatches(ctx, genres, atomic, func(genre *Genre) error {
+		return validateGenreParent(db, genre)
+	}, "Children")
+}
+
+// DeleteGenre deletes a genre. Its subgenres become top-level genres.
+func DeleteGenre(ctx context.Context, genre *Genre) error {
+	defer InvalidateCache(ctx, CacheGenres, CacheBooks)
+
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return deleteGenre(tx, genre)
+	})
+}
+
+func DeleteGenresByID(ctx context.Context, genreIDs []uint, atomic bool) ([]error, error) {
+	defer InvalidateCache(ctx, CacheGenres, CacheBooks)
+
+	return applyEach(ctx, genreIDs, atomic, func(db *gorm.DB, genreID uint) error {
+		var genre Genre
+		if err := db.First(&genre, genreID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("genre with ID %d does not exist", genreID)
+			}
+			return err
+		}
+		return deleteGenre(db, &genre)
+	})
+}
+
+func deleteGenre(db *gorm.DB, genre *Genre) error {
+	err := db.Model(&Genre{}).Where("parent_id = ?", genre.ID).Update("parent_id", nil).Error
+	if err != nil {
+		return err
 	}
+	return db.Delete(genre).Error
+}
 
-	return nil
+func UpdateGenre(ctx context.Context, genre *Genre) error {
+	defer InvalidateCache(ctx, CacheGenres, CacheBooks)
+
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return updateGenre(tx, genre)
+	})
+}
+
+func UpdateGenres(ctx context.Context, genres []Genre, atomic bool) ([]error, error) {
+	defer InvalidateCache(ctx, CacheGenres, CacheBooks)
+
+	return applyEach(ctx, genres, atomic, func(db *gorm.DB, genre Genre) error {
+		if genre.ID == 0 {
+			return errMissingID
+		}
+		return updateGenre(db, &genre)
+	})
 }
 
-func UpdateGenre(genre *Genre) error {
-	db := database.DB
-	result := db.Model(&genre).Updates(genre)
+func updateGenre(db *gorm.DB, genre *Genre) error {
+	if err := validateGenreParent(db, genre); err != nil {
+		return err
+	}
+
+	// Slugs follow names and can't be set directly.
+	genre.Slug = ""
+	if genre.Genre != "" {
+		var existing Genre
+		if err := db.Select("id", "genre", "slug").First(&existing, genre.ID).Error; err != nil {
+			return err
+		}
+		if existing.Genre != genre.Genre {
+			if err := renameGenre(db, genre, existing.Slug); err != nil {
+				return err
+			}
+		}
+	}
+
+	result := db.Model(&genre).Omit("Children").Updates(genre)
 
 	if result.Error != nil {
 		return result.Error
@@ -43,8 +132,85 @@ func UpdateGenre(genre *Genre) error {
 	return nil
 }
 
-func GetAllGenre() ([]Genre, error) {
-	db := database.DB
+// MoveGenre makes a genre a subgenre of parentID, or a top-level genre if
+// parentID is nil.
+func MoveGenre(ctx context.Context, genre *Genre, parentID *uint) error {
+	defer InvalidateCache(ctx, CacheGenres, CacheBooks)
+
+	db := database.DB.WithContext(ctx)
+	genre.ParentID = parentID
+	if err := validateGenreParent(db, genre); err != nil {
+		return err
+	}
+	return db.Model(genre).Update("parent_id", parentID).Error
+}
+
+// validateGenreParent checks that the parent of genre exists and isn't the
+// genre itself or one of its subgenres.
+func validateGenreParent(db *gorm.DB, genre *Genre) error {
+	if genre.ParentID == nil {
+		return nil
+	}
+	err := checkParent(db, "genres", genre.ID, *genre.ParentID)
+	switch {
+	case errors.Is(err, errParentCycle):
+		return fmt.Errorf("%w: genre %d can't be a subgenre of itself or of its subgenres", ErrInvalidGenreParent, genre.ID)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fmt.Errorf("%w: genre with ID %d doesn't exist", ErrInvalidGenreParent, *genre.ParentID)
+	}
+	return err
+}
+
+// GetGenreTree returns the top-level genres with their subgenres nested in
+// Children, each level ordered by name.
+func GetGenreTree(ctx context.Context) ([]Genre, error) {
+	byParent, err := genresByParent(ctx)
+	if err != nil {
+		return []Genre{}, err
+	}
+	return nestGenres(byParent, 0), nil
+}
+
+// GetGenreSubtree returns a genre with its subgenres nested in Children.
+func GetGenreSubtree(ctx context.Context, genre Genre) (Genre, error) {
+	byParent, err := genresByParent(ctx)
+	if err != nil {
+		return Genre{}, err
+	}
+	genre.Children = nestGenres(byParent, genre.ID)
+	return genre, nil
+}
+
+// genresByParent loads all genres ordered by name and groups them by
+// parent ID, using 0 for top-level genres.
+func genresByParent(ctx context.Context) (map[uint][]Genre, error) {
+	db := database.DB.WithContext(ctx)
+	var genres []Genre
+	if err := db.Order("genre").Find(&genres).Error; err != nil {
+		return nil, err
+	}
+
+	byParent := make(map[uint][]Genre)
+	for _, genre := range genres {
+		var parentID uint
+		if genre.ParentID != nil {
+			parentID = *genre.ParentID
+		}
+		byParent[parentID] = append(byParent[parentID], genre)
+	}
+	return byParent, nil
+}
+
+func nestGenres(byParent map[uint][]Genre, parentID uint) []Genre {
+	children := byParent[parentID]
+	for i := range children {
+		children[i].Children = nestGenres(byParent, children[i].ID)
+	}
+	return children
+}
+
+func GetAllGenre(ctx context.Context) ([]Genre, error) {
+	db := database.DB.WithContext(ctx)
 	var genres []Genre
 	result := db.Find(&genres)
 
@@ -55,14 +221,111 @@ func GetAllGenre() ([]Genre, error) {
 	return genres, nil
 }
 
-func GetGenreByName(name string) (Genre, error) {
-	db := database.DB
-	var genre Genre
-	result := db.Where("genre = ?", name).First(&genre)
+// GetGenre returns the genre with the given ID.
+func GetGenre(ctx context.Context, id uint) (Genre, error) {
+	return cached(ctx, fmt.Sprintf("%sid:%d", CacheGenres, id), func() (Genre, error) {
+		db := database.DB.WithContext(ctx)
+		var genre Genre
+		result := db.First(&genre, id)
+		if result.Error != nil {
+			return Genre{}, result.Error
+		}
+		return genre, nil
+	})
+}
+
+// GetGenreBySlug returns the genre with the given current slug.
+func GetGenreBySlug(ctx context.Context, slug string) (Genre, error) {
+	return cached(ctx, CacheGenres+"slug:"+slug, func() (Genre, error) {
+		db := database.DB.WithContext(ctx)
+		var genre Genre
+		result := db.Where("slug = ?", slug).First(&genre)
+		if result.Error != nil {
+			return Genre{}, result.Error
+		}
+		return genre, nil
+	})
+}
 
+// GetGenreByAlias returns the genre a former slug belonged to.
+func GetGenreByAlias(ctx context.Context, slug string) (Genre, error) {
+	db := database.DB.WithContext(ctx)
+	var genre Genre
+	result := db.Joins("JOIN genre_aliases ON genre_aliases.genre_id = genres.id").
+		Where("genre_aliases.slug = ?", slug).
+		First(&genre)
 	if result.Error != nil {
 		return Genre{}, result.Error
 	}
-
 	return genre, nil
 }
+
+// FindGenre returns the genre key refers to: its ID, its slug, a former
+// slug or its name. moved is true for the last two, which clients should
+// replace with the current slug.
+func FindGenre(ctx context.Context, key string) (genre Genre, moved bool, err error) {
+	if id, parseErr := strconv.ParseUint(key, 10, 0); parseErr == nil {
+		genre, err = GetGenre(ctx, uint(id))
+		return genre, false, err
+	}
+
+	genre, err = GetGenreBySlug(ctx, key)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return genre, false, err
+	}
+	genre, err = GetGenreByAlias(ctx, key)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		genre, err = GetGenreByName(ctx, key)
+	}
+	return genre, err == nil, err
+}
+
+func GetGenreByName(ctx context.Context, name string) (Genre, error) {
+	return cached(ctx, CacheGenres+"name:"+name, func() (Genre, error) {
+		db := database.DB.WithContext(ctx)
+		var genre Genre
+		result := db.Where("genre = ?", name).First(&genre)
+
+		if result.Error != nil {
+			return Genre{}, result.Error
+		}
+
+		return genre, nil
+	})
+}
+
+// FindGenres returns the genres ordered by name.
+func FindGenres(ctx context.Context, page Page) ([]Genre, error) {
+	db := database.DB.WithContext(ctx)
+	var genres []Genre
+	result := page.apply(db.Order("genre")).Find(&genres)
+	if result.Error != nil {
+		return []Genre{}, result.Error
+	}
+	return genres, nil
+}
+
+// GetGenresByBookIDs returns the genres of the given books, keyed by book
+// ID.
+func GetGenresByBookIDs(ctx context.Context, bookIDs []uint) (map[uint][]Genre, error) {
+	db := database.DB.WithContext(ctx)
+	var rows []struct {
+		Genre
+		BookID uint
+	}
+	result := db.Model(&Genre{}).
+		Select("genres.*, book_genre.book_id").
+		Joins("JOIN book_genre ON book_genre.genre_id = genres.id").
+		Where("book_genre.book_id IN ?", bookIDs).
+		Order("genres.genre").
+		Find(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	byBook := make(map[uint][]Genre)
+	for _, row := range rows {
+		byBook[row.BookID] = append(byBook[row.BookID], row.Genre)
+	}
+	return byBook, nil
+}
@@ -0,0 +1,251 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joseph-gunnarsson/book-api/internal/database"
+	"gorm.io/gorm"
+)
+
+const (
+	ImportJobPending   = "pending"
+	ImportJobRunning   = "running"
+	ImportJobCompleted = "completed"
+	ImportJobFailed    = "failed"
+	ImportJobCancelled = "cancelled"
+)
+
+// ImportJobLease is how long a claimed job belongs to its worker without
+// RenewImportJobLease being called. Jobs whose lease expired are requeued,
+// since the process running them has stopped.
+const ImportJobLease = 30 * time.Second
+
+// ErrImportJobFinished is returned when cancelling a job that has already
+// completed, failed or been cancelled, and by FinishImportJobTx for a job
+// that is no longer running under its claim.
+var ErrImportJobFinished = errors.New("import job has already finished")
+
+// ImportJob is a catalogue import processed in the background. The uploaded
+// file is kept in Payload until the job finishes so that it can be restarted
+// after a crash.
+type ImportJob struct {
+	gorm.Model
+	Status     string           `json:"status" gorm:"size:20;not null;index"`
+	Format     string           `json:"format" gorm:"size:20;not null"`
+	DryRun     bool             `json:"dryRun"`
+	Total      int              `json:"total"`
+	Processed  int              `json:"processed"`
+	Failed     int              `json:"failed"`
+	Errors     []ImportJobError `json:"errors" gorm:"serializer:json;type:longtext"`
+	Message    string           `json:"message,omitempty" gorm:"size:1000"`
+	StartedAt  *time.Time       `json:"startedAt"`
+	FinishedAt *time.Time       `json:"finishedAt"`
+	Payload    []byte           `json:"-" gorm:"type:longblob"`
+	// ClaimToken identifies the claim of a running job, so that a worker
+	// whose job was requeued and claimed again can't update it anymore.
+	ClaimToken     string     `json:"-" gorm:"size:32"`
+	LeaseExpiresAt *time.Time `json:"-" gorm:"index"`
+}
+
+type ImportJobError struct {
+	Row   int    `json:"row"`
+	Title string `json:"title,omitempty"`
+	Error string `json:"error"`
+}
+
+func CreateImportJob(ctx context.Context, job *ImportJob) error {
+	db := database.DB.WithContext(ctx)
+	result := db.Create(job)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func GetImportJob(ctx context.Context, id uint) (ImportJob, error) {
+	db := database.DB.WithContext(ctx)
+	var job ImportJob
+	result := db.Omit("Payload").First(&job, id)
+
+	if result.Error != nil {
+		return ImportJob{}, result.Error
+	}
+	return job, nil
+}
+
+// ClaimImportJob marks the oldest pending job as running and returns it
+// with a lease of ImportJobLease. The status is only changed if the job is
+// still pending, so concurrent workers never claim the same job.
+func ClaimImportJob(ctx context.Context) (ImportJob, bool, error) {
+	db := database.DB.WithContext(ctx)
+
+	for {
+		var job ImportJob
+		result := db.Select("id").Where("status = ?", ImportJobPending).Order("id").Limit(1).Find(&job)
+		if result.Error != nil {
+			return ImportJob{}, false, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ImportJob{}, false, nil
+		}
+
+		token, err := newClaimToken()
+		if err != nil {
+			return ImportJob{}, false, err
+		}
+		now := time.Now()
+		result = db.Model(&ImportJob{}).
+			Where("id = ? AND status = ?", job.ID, ImportJobPending).
+			Updates(map[string]interface{}{
+				"status":           ImportJobRunning,
+				"started_at":       now,
+				"claim_token":      token,
+				"lease_expires_at": now.Add(ImportJobLease),
+			})
+		if result.Error != nil {
+			return ImportJob{}, false, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		if err := db.First(&job, job.ID).Error; err != nil {
+			return ImportJob{}, false, err
+		}
+		return job, true, nil
+	}
+}
+
+func newClaimToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// claimed restricts a query to a job that is still running under the claim
+// of job.
+func claimed(db *gorm.DB, job ImportJob) *gorm.DB {
+	return db.Model(&ImportJob{}).Where("id = ? AND status = ? AND claim_token = ?", job.ID, ImportJobRunning, job.ClaimToken)
+}
+
+// RenewImportJobLease extends the lease of a claimed job by ImportJobLease.
+// It returns false if the job is no longer running under this claim, e.g.
+// because it was cancelled.
+func RenewImportJobLease(ctx context.Context, job ImportJob) (bool, error) {
+	db := database.DB.WithContext(ctx)
+	result := claimed(db, job).Update("lease_expires_at", time.Now().Add(ImportJobLease))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UpdateImportJobProgress records the progress of a claimed job. It returns
+// false if the job is no longer running under this claim, e.g. because it
+// was cancelled.
+func UpdateImportJobProgress(ctx context.Context, job ImportJob, total, processed, failed int) (bool, error) {
+	db := database.DB.WithContext(ctx)
+	result := claimed(db, job).
+		Updates(map[string]interface{}{"total": total, "processed": processed, "failed": failed})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// FinishImportJob stores the final status, counts and errors of a claimed
+// job and drops its payload.
+func FinishImportJob(ctx context.Context, job *ImportJob) error {
+	_, err := finishImportJob(database.DB.WithContext(ctx), job)
+	return err
+}
+
+// FinishImportJobTx is like FinishImportJob, but runs in tx, the transaction
+// of the import, so that the job only completes if the import is committed.
+// It returns ErrImportJobFinished if the job is no longer running under
+// this claim, e.g. because it was cancelled, so that tx is rolled back.
+func FinishImportJobTx(tx *gorm.DB, job *ImportJob) error {
+	ok, err := finishImportJob(tx, job)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: job %d is no longer running under this claim", ErrImportJobFinished, job.ID)
+	}
+	return nil
+}
+
+func finishImportJob(db *gorm.DB, job *ImportJob) (bool, error) {
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Payload = nil
+
+	result := claimed(db, *job).
+		Select("Status", "Total", "Processed", "Failed", "Errors", "Message", "FinishedAt", "Payload").
+		Updates(job)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CancelImportJob marks a pending or running job as cancelled. Stopping the
+// worker processing it is up to the caller.
+func CancelImportJob(ctx context.Context, id uint) (ImportJob, error) {
+	db := database.DB.WithContext(ctx)
+	result := db.Model(&ImportJob{}).
+		Where("id = ? AND status IN ?", id, []string{ImportJobPending, ImportJobRunning}).
+		Updates(map[string]interface{}{"status": ImportJobCancelled, "finished_at": time.Now(), "payload": nil})
+	if result.Error != nil {
+		return ImportJob{}, result.Error
+	}
+
+	job, err := GetImportJob(ctx, id)
+	if err != nil {
+		return ImportJob{}, err
+	}
+	if result.RowsAffected == 0 {
+		return job, fmt.Errorf("%w: job %d is %s", ErrImportJobFinished, id, job.Status)
+	}
+	return job, nil
+}
+
+// requeued resets a running job to pending, to be started again from the
+// beginning.
+var requeued = map[string]interface{}{
+	"status": ImportJobPending, "total": 0, "processed": 0, "failed": 0,
+	"started_at": nil, "claim_token": "", "lease_expires_at": nil,
+}
+
+// RequeueImportJob puts a claimed job back in the queue so that it is
+// started again from the beginning.
+func RequeueImportJob(ctx context.Context, job ImportJob) error {
+	db := database.DB.WithContext(ctx)
+	result := claimed(db, job).Updates(requeued)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// RequeueExpiredImportJobs puts running jobs whose lease expired back in the
+// queue. Their process stopped without finishing them, while jobs of live
+// processes, which renew their leases, are left alone. Jobs without a lease
+// were claimed before leases existed and are requeued too.
+func RequeueExpiredImportJobs(ctx context.Context) error {
+	db := database.DB.WithContext(ctx)
+	result := db.Model(&ImportJob{}).
+		Where("status = ? AND (lease_expires_at IS NULL OR lease_expires_at < ?)", ImportJobRunning, time.Now()).
+		Updates(requeued)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
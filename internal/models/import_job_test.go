@@ -0,0 +1,65 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// TestFinishImportJobTxAfterCancel checks that a job cancelled while its
+// import runs can't be completed by it, so that the import is rolled back.
+func TestFinishImportJobTxAfterCancel(t *testing.T) {
+	db := setupDB(t)
+	ctx := context.Background()
+
+	if err := CreateImportJob(ctx, &ImportJob{Status: ImportJobPending, Format: "csv"}); err != nil {
+		t.Fatal(err)
+	}
+	job, ok, err := ClaimImportJob(ctx)
+	if err != nil || !ok {
+		t.Fatalf("ClaimImportJob: %v, %v", ok, err)
+	}
+	if _, err := CancelImportJob(ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	job.Status = ImportJobCompleted
+	if err := FinishImportJobTx(db, &job); !errors.Is(err, ErrImportJobFinished) {
+		t.Fatalf("FinishImportJobTx after cancel: got %v, want ErrImportJobFinished", err)
+	}
+	got, err := GetImportJob(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != ImportJobCancelled {
+		t.Errorf("status = %q, want %q", got.Status, ImportJobCancelled)
+	}
+}
+
+// TestCancelImportJobAfterFinish checks that a job completed by its import
+// can't be cancelled anymore.
+func TestCancelImportJobAfterFinish(t *testing.T) {
+	db := setupDB(t)
+	ctx := context.Background()
+
+	if err := CreateImportJob(ctx, &ImportJob{Status: ImportJobPending, Format: "csv"}); err != nil {
+		t.Fatal(err)
+	}
+	job, ok, err := ClaimImportJob(ctx)
+	if err != nil || !ok {
+		t.Fatalf("ClaimImportJob: %v, %v", ok, err)
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		job.Status = ImportJobCompleted
+		return FinishImportJobTx(tx, &job)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CancelImportJob(ctx, job.ID); !errors.Is(err, ErrImportJobFinished) {
+		t.Errorf("CancelImportJob after finish: got %v, want ErrImportJobFinished", err)
+	}
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/joseph-gunnarsson/book-api/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AllModels returns every model whose table is created by AutoMigrate.
+func AllModels() []interface{} {
+	return []interface{}{&Author{}, &Book{}, &BookContributor{}, &Genre{}, &Publisher{}, &Series{}, &Work{}, &GenreAlias{}, &ImportJob{}}
+}
+
+// CheckMigrations returns an error if the table of any model is missing.
+func CheckMigrations(ctx context.Context) error {
+	migrator := database.DB.WithContext(ctx).Migrator()
+	for _, model := range AllModels() {
+		if !migrator.HasTable(model) {
+			return fmt.Errorf("table for %T is missing", model)
+		}
+	}
+	return nil
+}
+
+// Page selects a slice of a result. A zero Limit means no limit.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+func (p Page) apply(db *gorm.DB) *gorm.DB {
+	if p.Limit > 0 {
+		db = db.Limit(p.Limit)
+	}
+	if p.Offset > 0 {
+		db = db.Offset(p.Offset)
+	}
+	return db
+}
+
+// Sort orders a result by a column. The zero value keeps the default order.
+type Sort struct {
+	Column string
+	Desc   bool
+}
+
+// parseSort parses a sort parameter like "title" or "-releaseDate", where a
+// leading "-" means descending order. columns maps the accepted field names
+// to column names.
+func parseSort(value string, columns map[string]string) (Sort, error) {
+	if value == "" {
+		return Sort{}, nil
+	}
+	desc := strings.HasPrefix(value, "-")
+	column, ok := columns[strings.TrimPrefix(value, "-")]
+	if !ok {
+		return Sort{}, fmt.Errorf("can't sort by %q", strings.TrimPrefix(value, "-"))
+	}
+	return Sort{Column: column, Desc: desc}, nil
+}
+
+func (s Sort) apply(db *gorm.DB) *gorm.DB {
+	if s.Column == "" {
+		return db
+	}
+	return db.Order(clause.OrderByColumn{Column: clause.Column{Name: s.Column}, Desc: s.Desc})
+}
+
+// containsPattern returns a LIKE pattern matching values containing s.
+func containsPattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/joseph-gunnarsson/book-api/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupDB points database.DB at a new SQLite database with every table
+// migrated, for the duration of the test.
+func setupDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db") + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(1000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(AllModels()...); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// createAuthor creates an author for a test.
+func createAuthor(t *testing.T, db *gorm.DB) Author {
+	t.Helper()
+	author := Author{FirstName: "Ursula", LastName: "Le Guin"}
+	if err := db.Create(&author).Error; err != nil {
+		t.Fatal(err)
+	}
+	return author
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/joseph-gunnarsson/book-api/internal/database"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidParent is returned when a publisher's parent doesn't exist
+	// or would make the publisher an imprint of itself.
+	ErrInvalidParent = errors.New("invalid parent publisher")
+	// ErrInvalidPublisher is returned when a book's publisher doesn't exist.
+	ErrInvalidPublisher = errors.New("invalid publisher")
+)
+
+// Publisher is a publishing house. Imprints are publishers with a ParentID.
+type Publisher struct {
+	gorm.Model
+	Name     string      `json:"name" gorm:"size:255;not null;unique"`
+	Country  string      `json:"country" gorm:"size:50"`
+	Website  string      `json:"website" gorm:"size:255"`
+	ParentID *uint       `json:"parentID" gorm:"index"`
+	Parent   *Publisher  `json:"parent,omitempty" gorm:"constraint:OnDelete:SET NULL;"`
+	Imprints []Publisher `json:"imprints,omitempty" gorm:"foreignKey:ParentID"`
+}
+
+func CreatePublisher(ctx context.Context, publisher *Publisher) error {
+	defer InvalidateCache(ctx, CacheBooks)
+
+	db := database.DB.WithContext(ctx)
+	if err := validateParent(db, publisher); err != nil {
+		return err
+	}
+
+	result := db.Omit("Parent", "Imprints").Create(publisher)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// UpdatePublisher updates the non-empty fields of a publisher. Its parent
+// is only updated if setParent is true, in which case a nil ParentID makes
+// it a top-level publisher.
+func UpdatePublisher(ctx context.Context, publisher *Publisher, setParent bool) error {
+	defer InvalidateCache(ctx, CacheBooks)
+
+	db := database.DB.WithContext(ctx)
+	if err := validateParent(db, publisher); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&publisher).Omit("ParentID", "Parent", "Imprints").Updates(publisher)
+		if result.Error != nil {
+			return result.Error
+		}
+		if setParent {
+			return tx.Model(&publisher).Update("parent_id", publisher.ParentID).Error
+		}
+		return nil
+	})
+}
+
+// DeletePublisher deletes a publisher. Its imprints become top-level
+// publishers and its books lose their publisher.
+func DeletePublisher(ctx context.Context, publisher *Publisher) error {
+	defer InvalidateCache(ctx, CacheBooks)
+
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Publisher{}).Where("parent_id = ?", publisher.ID).Update("parent_id", nil).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&Book{}).Where("publisher_id = ?", publisher.ID).Update("publisher_id", nil).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(publisher).Error
+	})
+}
+
+// validateParent checks that the parent of publisher exists and isn't the
+// publisher itself or one of its imprints.
+func validateParent(db *gorm.DB, publisher *Publisher) error {
+	if publisher.ParentID == nil {
+		return nil
+	}
+	err := checkParent(db, "publishers", publisher.ID, *publisher.ParentID)
+	switch {
+	case errors.Is(err, errParentCycle):
+		return fmt.Errorf("%w: publisher %d can't be an imprint of itself", ErrInvalidParent, publisher.ID)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fmt.Errorf("%w: publisher with ID %d doesn't exist", ErrInvalidParent, *publisher.ParentID)
+	}
+	return err
+}
+
+func GetAllPublishers(ctx context.Context) ([]Publisher, error) {
+	db := database.DB.WithContext(ctx)
+	var publishers []Publisher
+	result := db.Order("id").Find(&publishers)
+	if result.Error != nil {
+		return []Publisher{}, result.Error
+	}
+	return publishers, nil
+}
+
+// GetPublisher returns a publisher with its parent and direct imprints.
+func GetPublisher(ctx context.Context, id uint) (Publisher, error) {
+	db := database.DB.WithContext(ctx)
+	var publisher Publisher
+	result := db.Preload("Parent").Preload("Imprints").First(&publisher, id)
+	if result.Error != nil {
+		return Publisher{}, result.Error
+	}
+	return publisher, nil
+}
+
+// validatePublisher checks that the publisher of a book exists.
+func validatePublisher(db *gorm.DB, book *Book) error {
+	if book.PublisherID == nil {
+		return nil
+	}
+	if err := db.Select("id").First(&Publisher{}, *book.PublisherID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: publisher with ID %d doesn't exist", ErrInvalidPublisher, *book.PublisherID)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/joseph-gunnarsson/book-api/internal/database"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidSeries is returned when a book has a series that doesn't exist,
+// or a series position without a series.
+var ErrInvalidSeries = errors.New("invalid series")
+
+// Series is a sequence of books meant to be read in order.
+type Series struct {
+	gorm.Model
+	Name        string `json:"name" gorm:"size:255;not null;unique"`
+	Description string `json:"description" gorm:"size:1000"`
+}
+
+// SeriesNeighbour is the book before or after a book in its series.
+type SeriesNeighbour struct {
+	ID             uint    `json:"ID"`
+	Title          string  `json:"title"`
+	SeriesPosition float64 `json:"seriesPosition"`
+}
+
+func CreateSeries(ctx context.Context, series *Series) error {
+	db := database.DB.WithContext(ctx)
+	result := db.Create(series)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func UpdateSeries(ctx context.Context, series *Series) error {
+	defer InvalidateCache(ctx, CacheBooks)
+
+	db := database.DB.WithContext(ctx)
+	result := db.Model(&series).Updates(series)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// DeleteSeries deletes a series. Its books are kept outside of any series.
+func DeleteSeries(ctx context.Context, series *Series) error {
+	defer InvalidateCache(ctx, CacheBooks)
+
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Book{}).Where("series_id = ?", series.ID).
+			Updates(map[string]interface{}{"series_id": nil, "series_position": nil}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(series).Error
+	})
+}
+
+func GetAllSeries(ctx context.Context) ([]Series, error) {
+	db := database.DB.WithContext(ctx)
+	var series []Series
+	result := db.Order("name").Find(&series)
+	if result.Error != nil {
+		return []Series{}, result.Error
+	}
+	return series, nil
+}
+
+func GetSeries(ctx context.Context, id uint) (Series, error) {
+	db := database.DB.WithContext(ctx)
+	var series Series
+	result := db.First(&series, id)
+	if result.Error != nil {
+		return Series{}, result.Error
+	}
+	return series, nil
+}
+
+// validateSeries checks that the series of a book exists and that it has
+// one if it has a series position. For an update, the book's current series
+// counts unless keys, the JSON keys of the update, include seriesID.
+func validateSeries(db *gorm.DB, book *Book, keys map[string]bool) error {
+	if book.SeriesID != nil {
+		if err := db.Select("id").First(&Series{}, *book.SeriesID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: series with ID %d doesn't exist", ErrInvalidSeries, *book.SeriesID)
+			}
+			return err
+		}
+		return nil
+	}
+	if book.SeriesPosition == nil {
+		return nil
+	}
+
+	if book.ID != 0 && !keys["seriesID"] {
+		var current Book
+		if err := db.Select("id", "series_id").First(&current, book.ID).Error; err != nil {
+			return err
+		}
+		if current.SeriesID != nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: a series position needs a series", ErrInvalidSeries)
+}
+
+// loadSeriesNeighbours sets the previous and next books of a book in its
+// series. Books sharing its position aren't neighbours.
+func loadSeriesNeighbours(db *gorm.DB, book *Book) error {
+	if book.SeriesID == nil || book.SeriesPosition == nil {
+		return nil
+	}
+
+	neighbour := func(condition, order string) (*SeriesNeighbour, error) {
+		var neighbours []SeriesNeighbour
+		err := db.Model(&Book{}).
+			Select("id", "title", "series_position").
+			Where("series_id = ?", *book.SeriesID).
+			Where(condition, *book.SeriesPosition).
+			Order(order).
+			Limit(1).
+			Find(&neighbours).Error
+		if err != nil || len(neighbours) == 0 {
+			return nil, err
+		}
+		return &neighbours[0], nil
+	}
+
+	var err error
+	if book.Previous, err = neighbour("series_position < ?", "series_position DESC, id DESC"); err != nil {
+		return err
+	}
+	book.Next, err = neighbour("series_position > ?", "series_position, id")
+	return err
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/joseph-gunnarsson/book-api/internal/database"
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxSlugLength leaves room in the slug column for a "-n" suffix.
+const maxSlugLength = 240
+
+// GenreAlias is a former slug of a genre, kept so that URLs using it keep
+// working after the genre is renamed.
+type GenreAlias struct {
+	Slug      string `gorm:"primaryKey;size:255"`
+	GenreID   uint   `gorm:"not null;index"`
+	Genre     Genre  `gorm:"constraint:OnDelete:CASCADE;"`
+	CreatedAt time.Time
+}
+
+// slugify turns a name into lowercase letters and digits joined by
+// hyphens. Accents are dropped, so "Ciencia ficción" becomes
+// "ciencia-ficcion", while letters without an ASCII form, like those of
+// "科幻", are kept.
+func slugify(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range norm.NFKD.String(name) {
+		switch {
+		case unicode.Is(unicode.Mn, r), r == '\'', r == '’':
+			continue
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			hyphen = true
+		}
+	}
+
+	slug := []rune(b.String())
+	if len(slug) > maxSlugLength {
+		slug = slug[:maxSlugLength]
+	}
+	return strings.TrimSuffix(string(slug), "-")
+}
+
+// reservedGenreSlugs are taken by routes under /genres, like /genres/bulk,
+// which a genre with the same slug couldn't be reached through.
+var reservedGenreSlugs = map[string]bool{
+	"bulk": true,
+}
+
+// uniqueGenreSlug returns the slug of name, suffixed with -2, -3 and so on
+// if another genre has it, it is reserved or it is in assigned. Slugs that
+// would read as IDs get a "genre-" prefix.
+func uniqueGenreSlug(db *gorm.DB, name string, genreID uint, assigned map[string]bool) (string, error) {
+	base := slugify(name)
+	if strings.Trim(base, "0123456789") == "" {
+		base = strings.TrimSuffix("genre-"+base, "-")
+	}
+
+	for n := 1; ; n++ {
+		slug := base
+		if n > 1 {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		if assigned[slug] || reservedGenreSlugs[slug] {
+			continue
+		}
+		var taken int64
+		// Deleted genres keep their slug in the unique index.
+		err := db.Unscoped().Model(&Genre{}).Where("slug = ? AND id <> ?", slug, genreID).Count(&taken).Error
+		if err != nil {
+			return "", err
+		}
+		if taken == 0 {
+			return slug, nil
+		}
+	}
+}
+
+// setGenreSlug gives a genre the slug of its name, avoiding the slugs in
+// assigned, and adds it to them. An alias with the same slug is dropped,
+// since current slugs take precedence.
+func setGenreSlug(db *gorm.DB, genre *Genre, assigned map[string]bool) error {
+	slug, err := uniqueGenreSlug(db, genre.Genre, genre.ID, assigned)
+	if err != nil {
+		return err
+	}
+	genre.Slug = slug
+	if assigned != nil {
+		assigned[slug] = true
+	}
+	return db.Where("slug = ?", slug).Delete(&GenreAlias{}).Error
+}
+
+// assignedSlugsKey stores the slugs given to genres earlier in the same
+// statement. A batch insert runs BeforeCreate for all of its genres before
+// inserting any, so the database can't tell that their slugs are taken.
+const assignedSlugsKey = "models:assigned_genre_slugs"
+
+// BeforeCreate gives new genres a slug. Genres only referenced by ID, like
+// the genres of a created book, are left alone.
+func (g *Genre) BeforeCreate(tx *gorm.DB) error {
+	if g.ID != 0 && g.Genre == "" {
+		return nil
+	}
+	assigned, _ := tx.Statement.Settings.LoadOrStore(assignedSlugsKey, map[string]bool{})
+	return setGenreSlug(tx.Session(&gorm.Session{NewDB: true}), g, assigned.(map[string]bool))
+}
+
+// renameGenre sets the slug of a renamed genre and keeps its old slug as an
+// alias.
+func renameGenre(db *gorm.DB, genre *Genre, oldSlug string) error {
+	if err := setGenreSlug(db, genre, nil); err != nil {
+		return err
+	}
+	if oldSlug == "" || oldSlug == genre.Slug {
+		return nil
+	}
+	alias := GenreAlias{Slug: oldSlug, GenreID: genre.ID}
+	return db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&alias).Error
+}
+
+// BackfillGenreSlugs gives a slug to every genre created before slugs
+// existed. It is run after AutoMigrate.
+func BackfillGenreSlugs(ctx context.Context) error {
+	db := database.DB.WithContext(ctx)
+	var genres []Genre
+	err := db.Unscoped().Where("slug IS NULL OR slug = ''").Order("id").Find(&genres).Error
+	if err != nil {
+		return err
+	}
+
+	for _, genre := range genres {
+		slug, err := uniqueGenreSlug(db, genre.Genre, genre.ID, nil)
+		if err != nil {
+			return err
+		}
+		err = db.Unscoped().Model(&genre).UpdateColumn("slug", slug).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
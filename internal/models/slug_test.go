@@ -0,0 +1,26 @@
+package models
+
+import (
+	"context"
+	"testing"
+)
+
+// TestGenreSlugs checks the slugs given to new genres, including ones that
+// would clash with an ID, a route or a genre in the same batch.
+func TestGenreSlugs(t *testing.T) {
+	setupDB(t)
+	ctx := context.Background()
+
+	genres := []Genre{{Genre: "Science Fiction"}, {Genre: "Science fiction!"}, {Genre: "Bulk"}, {Genre: "1984"}}
+	errs, err := CreateGenres(ctx, genres, true)
+	if err != nil {
+		t.Fatalf("CreateGenres: %v (%v)", err, errs)
+	}
+
+	want := []string{"science-fiction", "science-fiction-2", "bulk-2", "genre-1984"}
+	for i, genre := range genres {
+		if genre.Slug != want[i] {
+			t.Errorf("slug of %q = %q, want %q", genre.Genre, genre.Slug, want[i])
+		}
+	}
+}
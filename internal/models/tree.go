@@ -0,0 +1,56 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// errParentCycle is returned by checkParent when a record would become its
+// own ancestor.
+var errParentCycle = errors.New("record would be its own ancestor")
+
+// treeNode is a row of a table whose records form a tree through parent_id,
+// like genres and publishers.
+type treeNode struct {
+	ID       uint
+	ParentID *uint
+}
+
+// checkParent walks up the tree in table from parentID and returns
+// errParentCycle if it reaches the record with the given ID, which is 0 for
+// a new record, and gorm.ErrRecordNotFound if the parent doesn't exist.
+func checkParent(db *gorm.DB, table string, id, parentID uint) error {
+	next := parentID
+	for {
+		if id != 0 && next == id {
+			return errParentCycle
+		}
+		var node treeNode
+		err := db.Table(table).Select("id", "parent_id").Where("id = ? AND deleted_at IS NULL", next).Take(&node).Error
+		if err != nil {
+			return err
+		}
+		if node.ParentID == nil {
+			return nil
+		}
+		next = *node.ParentID
+	}
+}
+
+// descendantIDs returns the ID of a record in table and of all records
+// below it in the tree.
+func descendantIDs(db *gorm.DB, table string, id uint) ([]uint, error) {
+	ids := []uint{id}
+	level := []uint{id}
+	for len(level) > 0 {
+		var children []uint
+		err := db.Table(table).Where("parent_id IN ? AND deleted_at IS NULL", level).Pluck("id", &children).Error
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, children...)
+		level = children
+	}
+	return ids, nil
+}
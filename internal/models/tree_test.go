@@ -0,0 +1,66 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// TestGenreTree checks that genres can't be moved below themselves or
+// under a missing genre, and that descendants include every level.
+func TestGenreTree(t *testing.T) {
+	db := setupDB(t)
+	ctx := context.Background()
+
+	fiction := Genre{Genre: "Fiction"}
+	if err := CreateGenre(ctx, &fiction); err != nil {
+		t.Fatal(err)
+	}
+	sf := Genre{Genre: "Science Fiction", ParentID: &fiction.ID}
+	if err := CreateGenre(ctx, &sf); err != nil {
+		t.Fatal(err)
+	}
+	cyberpunk := Genre{Genre: "Cyberpunk", ParentID: &sf.ID}
+	if err := CreateGenre(ctx, &cyberpunk); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MoveGenre(ctx, &fiction, &cyberpunk.ID); !errors.Is(err, ErrInvalidGenreParent) {
+		t.Errorf("moving a genre below its subgenre: got %v, want ErrInvalidGenreParent", err)
+	}
+	missing := uint(99)
+	if err := MoveGenre(ctx, &sf, &missing); !errors.Is(err, ErrInvalidGenreParent) {
+		t.Errorf("moving a genre under a missing genre: got %v, want ErrInvalidGenreParent", err)
+	}
+
+	ids, err := descendantIDs(db, "genres", fiction.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(ids)
+	if want := []uint{fiction.ID, sf.ID, cyberpunk.ID}; !slices.Equal(ids, want) {
+		t.Errorf("descendants of Fiction = %v, want %v", ids, want)
+	}
+}
+
+// TestPublisherParent checks that publishers can't become imprints of
+// their own imprints.
+func TestPublisherParent(t *testing.T) {
+	setupDB(t)
+	ctx := context.Background()
+
+	house := Publisher{Name: "Harper & Row"}
+	if err := CreatePublisher(ctx, &house); err != nil {
+		t.Fatal(err)
+	}
+	imprint := Publisher{Name: "Harper Voyager", ParentID: &house.ID}
+	if err := CreatePublisher(ctx, &imprint); err != nil {
+		t.Fatal(err)
+	}
+
+	house.ParentID = &imprint.ID
+	if err := UpdatePublisher(ctx, &house, true); !errors.Is(err, ErrInvalidParent) {
+		t.Errorf("making a publisher an imprint of its imprint: got %v, want ErrInvalidParent", err)
+	}
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"context"
+
 	"gorm.io/gorm"
 )
 
@@ -10,6 +12,6 @@ type User struct {
 	Password string `json:"-" gorm:"size:72;not null;"`
 }
 
-func CreateUser(user *User) {
+func CreateUser(ctx context.Context, user *User) {
 
 }
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/joseph-gunnarsson/book-api/internal/database"
+	"gorm.io/gorm"
+)
+
+// Edition formats.
+const (
+	FormatHardcover = "hardcover"
+	FormatPaperback = "paperback"
+	FormatEbook     = "ebook"
+	FormatAudiobook = "audiobook"
+)
+
+var editionFormats = map[string]bool{
+	FormatHardcover: true,
+	FormatPaperback: true,
+	FormatEbook:     true,
+	FormatAudiobook: true,
+}
+
+// languageTag matches language tags like "en", "pt-BR" or "zh-Hant".
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{1,8})*$`)
+
+var (
+	// ErrInvalidEdition is returned when a book has an unknown format or
+	// work, a non-positive page count or a malformed language.
+	ErrInvalidEdition = errors.New("invalid edition")
+	// ErrWorkHasEditions is returned when deleting a work that still has
+	// editions.
+	ErrWorkHasEditions = errors.New("work has editions")
+)
+
+// Work is a book as written, like a novel, independent of how it is
+// published. Each Book is an edition of a work.
+type Work struct {
+	gorm.Model
+	Title       string `json:"title" gorm:"size:255;not null;index"`
+	Description string `json:"description" gorm:"size:1000"`
+	// Editions is only loaded for a single work.
+	Editions []Book `json:"editions,omitempty" gorm:"foreignKey:WorkID"`
+}
+
+func CreateWork(ctx context.Context, work *Work) error {
+	db := database.DB.WithContext(ctx)
+	result := db.Omit("Editions").Create(work)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+func UpdateWork(ctx context.Context, work *Work) error {
+	defer InvalidateCache(ctx, CacheBooks)
+
+	db := database.DB.WithContext(ctx)
+	result := db.Model(&work).Omit("Editions").Updates(work)
+	if result.Error != nil {
+		return result.Error
+	}
+	return nil
+}
+
+// DeleteWork deletes a work without editions. It returns ErrWorkHasEditions
+// otherwise, so that editions are deleted or moved to another work first.
+func DeleteWork(ctx context.Context, work *Work) error {
+	defer InvalidateCache(ctx, CacheBooks)
+
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var editions int64
+		if err := tx.Model(&Book{}).Where("work_id = ?", work.ID).Count(&editions).Error; err != nil {
+			return err
+		}
+		if editions > 0 {
+			return fmt.Errorf("%w: work %d has %d editions", ErrWorkHasEditions, work.ID, editions)
+		}
+		return tx.Delete(work).Error
+	})
+}
+
+func GetAllWorks(ctx context.Context) ([]Work, error) {
+	db := database.DB.WithContext(ctx)
+	var works []Work
+	result := db.Order("id").Find(&works)
+	if result.Error != nil {
+		return []Work{}, result.Error
+	}
+	return works, nil
+}
+
+// GetWork returns a work with its editions, oldest first, and their
+// authors.
+func GetWork(ctx context.Context, id uint) (Work, error) {
+	db := database.DB.WithContext(ctx)
+	var work Work
+	result := db.Preload("Editions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("release_date, id")
+	}).Preload("Editions.Author").First(&work, id)
+	if result.Error != nil {
+		return Work{}, result.Error
+	}
+	return work, nil
+}
+
+// CheckWork returns gorm.ErrRecordNotFound if the work doesn't exist,
+// without loading it like GetWork does.
+func CheckWork(ctx context.Context, id uint) error {
+	db := database.DB.WithContext(ctx)
+	return db.Select("id").First(&Work{}, id).Error
+}
+
+// validateEdition checks the format, page count, language and work of a
+// book. Empty fields aren't checked.
+func validateEdition(db *gorm.DB, book *Book) error {
+	if book.Format != "" && !editionFormats[book.Format] {
+		return fmt.Errorf("%w: unknown format %q", ErrInvalidEdition, book.Format)
+	}
+	if book.PageCount != nil && *book.PageCount < 1 {
+		return fmt.Errorf("%w: page count must be positive", ErrInvalidEdition)
+	}
+	if book.Language != "" && !languageTag.MatchString(book.Language) {
+		return fmt.Errorf("%w: malformed language %q", ErrInvalidEdition, book.Language)
+	}
+	if book.WorkID != nil {
+		if err := db.Select("id").First(&Work{}, *book.WorkID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: work with ID %d doesn't exist", ErrInvalidEdition, *book.WorkID)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// assignedWorksKey stores the works given to books earlier in the same
+// statement. A batch insert runs BeforeCreate for all of its books before
+// inserting any, so editions of the same work in one batch can't find each
+// other in the database.
+const assignedWorksKey = "models:assigned_works"
+
+// workKey identifies the work of a book created without one.
+type workKey struct {
+	title    string
+	authorID int
+}
+
+// findOrCreateWork sets the work of a book created without one. It reuses
+// the work of another edition with the same title and author, and creates
+// a work from the book otherwise. assigned holds the works given to books
+// not inserted yet and may be nil.
+func findOrCreateWork(db *gorm.DB, book *Book, assigned map[workKey]uint) error {
+	key := workKey{book.Title, book.AuthorID}
+	if id, ok := assigned[key]; ok {
+		book.WorkID = &id
+		return nil
+	}
+
+	var works []Work
+	err := db.Model(&Work{}).
+		Select("works.id").
+		Joins("JOIN books ON books.work_id = works.id AND books.deleted_at IS NULL").
+		Where("works.title = ? AND books.author_id = ?", book.Title, book.AuthorID).
+		Order("works.id").
+		Limit(1).
+		Find(&works).Error
+	if err != nil {
+		return err
+	}
+	if len(works) > 0 {
+		book.WorkID = &works[0].ID
+		return nil
+	}
+
+	work := Work{Title: book.Title, Description: book.Description}
+	if err := db.Create(&work).Error; err != nil {
+		return err
+	}
+	book.WorkID = &work.ID
+	if assigned != nil {
+		assigned[key] = work.ID
+	}
+	return nil
+}
+
+// MigrateEditions moves books created before works existed to the
+// work/edition model. It drops the unique index on book titles, which kept
+// editions of the same work apart, and gives every book without a work one
+// of its own. It is run after AutoMigrate.
+func MigrateEditions(ctx context.Context) error {
+	db := database.DB.WithContext(ctx)
+	migrator := db.Migrator()
+	if migrator.HasIndex(&Book{}, "title") {
+		if err := migrator.DropIndex(&Book{}, "title"); err != nil {
+			return err
+		}
+	}
+
+	var books []Book
+	result := db.Select("id", "title", "description").Where("work_id IS NULL").
+		FindInBatches(&books, BulkBatchSize, func(*gorm.DB, int) error {
+			return db.Transaction(func(tx *gorm.DB) error {
+				for _, book := range books {
+					work := Work{Title: book.Title, Description: book.Description}
+					if err := tx.Create(&work).Error; err != nil {
+						return err
+					}
+					if err := tx.Model(&Book{}).Where("id = ?", book.ID).Update("work_id", work.ID).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		})
+	return result.Error
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestCreateBooksSharesWork checks that editions of the same work created in
+// one batch get a single work, in both bulk modes.
+func TestCreateBooksSharesWork(t *testing.T) {
+	for _, atomic := range []bool{true, false} {
+		db := setupDB(t)
+		author := createAuthor(t, db)
+
+		books := []Book{
+			{Title: "The Dispossessed", ISBN: "9780061054884", AuthorID: int(author.ID), ReleaseDate: time.Date(1974, 5, 1, 0, 0, 0, 0, time.UTC), Format: FormatHardcover},
+			{Title: "The Dispossessed", ISBN: "9780060512750", AuthorID: int(author.ID), ReleaseDate: time.Date(1994, 1, 1, 0, 0, 0, 0, time.UTC), Format: FormatPaperback},
+		}
+		errs, err := CreateBooks(context.Background(), books, atomic)
+		if err != nil {
+			t.Fatalf("atomic=%v: CreateBooks: %v", atomic, err)
+		}
+		for i, err := range errs {
+			if err != nil {
+				t.Fatalf("atomic=%v: book %d: %v", atomic, i, err)
+			}
+		}
+
+		var works int64
+		if err := db.Model(&Work{}).Count(&works).Error; err != nil {
+			t.Fatal(err)
+		}
+		if works != 1 {
+			t.Errorf("atomic=%v: created %d works, want 1", atomic, works)
+		}
+		if books[0].WorkID == nil || books[1].WorkID == nil || *books[0].WorkID != *books[1].WorkID {
+			t.Errorf("atomic=%v: editions have different works", atomic)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/joseph-gunnarsson/book-api/internal/logging"
+)
+
+// Middleware limits requests per client, with separate buckets for reads
+// (GET, HEAD and OPTIONS) and writes. A zero limit disables limiting for
+// that kind of request. Every limited response carries RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers, and rejected requests
+// get a 429 with Retry-After.
+//
+// If the store fails, requests are let through rather than failing the API
+// along with the store.
+func Middleware(store Store, read, write Limit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			kind, limit := "write", write
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				kind, limit = "read", read
+			}
+			if !limit.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result, err := store.Take(r.Context(), kind+":"+ClientKey(r), limit)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("Failed to check rate limit", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+			header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", limit.Burst, ceilSeconds(seconds(float64(limit.Burst)/limit.Rate))))
+			if !result.Allowed {
+				header.Set("Retry-After", ceilSeconds(result.RetryAfter))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientKey identifies the client of a request by its IP address. API keys
+// and basic auth user names aren't verified, so keying on them, even
+// together with the IP, would let a client get a fresh limit by making up
+// new ones.
+func ClientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
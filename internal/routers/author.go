@@ -2,39 +2,44 @@ package routers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/joseph-gunnarsson/book-api/internal/logging"
 	"github.com/joseph-gunnarsson/book-api/internal/models"
+	"gorm.io/gorm"
 )
 
-func AuthorRoutes(r *chi.Mux) {
+func AuthorRoutes(r chi.Router) {
 	r.Get("/authors", GetAllAuthors)
 	r.Post("/authors", CreateAuthor)
 	r.Put("/authors/{id}", UpdateAuthor)
+	r.Patch("/authors/{id}", UpdateAuthor)
 	r.Get("/authors/{id}", GetAuthorByID)
 	r.Delete("/authors/{id}", DeleteAuthor)
+	r.Get("/authors/{id}/books", GetAuthorBooks)
 }
 
 func DeleteAuthor(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	authorID, err := strconv.Atoi(id)
 	if err != nil {
-		handleErrorResponse(w, "Invalid author ID parameter", err, http.StatusBadRequest)
+		handleErrorResponse(w, r, "Invalid author ID parameter", err, http.StatusBadRequest)
 		return
 	}
 
-	author, err := models.GetAuthor(uint(authorID))
+	author, err := models.GetAuthor(r.Context(), uint(authorID))
 	if err != nil {
-		handleErrorResponse(w, "Failed to get author", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to get author", err, http.StatusInternalServerError)
 		return
 	}
 
-	err = models.DeleteAuthor(&author)
+	err = models.DeleteAuthor(r.Context(), &author)
 	if err != nil {
-		handleErrorResponse(w, "Failed to delete author", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to delete author", err, http.StatusInternalServerError)
 		return
 	}
 
@@ -45,13 +50,13 @@ func DeleteAuthor(w http.ResponseWriter, r *http.Request) {
 
 	data, err := json.Marshal(responseJSON)
 	if err != nil {
-		handleErrorResponse(w, "Failed to marshal response", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to marshal response", err, http.StatusInternalServerError)
 		return
 	}
 
 	_, err = w.Write(data)
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
+		logging.FromContext(r.Context()).Error("Failed to write response", "error", err)
 	}
 }
 
@@ -59,122 +64,137 @@ func UpdateAuthor(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	authorID, err := strconv.Atoi(id)
 	if err != nil {
-		handleErrorResponse(w, "Invalid author ID parameter", err, http.StatusBadRequest)
+		handleErrorResponse(w, r, "Invalid author ID parameter", err, http.StatusBadRequest)
 		return
 	}
 
 	var author models.Author
-	err = json.NewDecoder(r.Body).Decode(&author)
+	err = decodeJSON(w, r, &author, MaxBodyBytes)
 	if err != nil {
-		handleErrorResponse(w, "Failed to decode JSON", err, http.StatusBadRequest)
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
 		return
 	}
 	author.ID = uint(authorID)
 
-	err = models.UpdateAuthor(&author)
+	err = models.UpdateAuthor(r.Context(), &author)
 	if err != nil {
-		handleErrorResponse(w, "Failed to update author", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to update author", err, http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
-	responseJSON := map[string]interface{}{
-		"message": "Author updated successfully",
-	}
-
-	data, err := json.Marshal(responseJSON)
+	updated, err := models.GetAuthor(r.Context(), uint(authorID))
 	if err != nil {
-		handleErrorResponse(w, "Failed to marshal response", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to get updated author", err, http.StatusInternalServerError)
 		return
 	}
 
-	_, err = w.Write(data)
-	if err != nil {
-		log.Printf("Error writing response: %v", err)
-	}
+	respondJSON(w, r, updated, http.StatusOK)
 }
 
 func GetAllAuthors(w http.ResponseWriter, r *http.Request) {
-	authors, err := models.GetAllAuthors()
+	fields, err := models.ParseAuthorFields(r.URL.Query().Get("fields"), r.URL.Query().Get("include"))
 	if err != nil {
-		handleErrorResponse(w, "Failed to get authors", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Invalid fields or include parameter", err, http.StatusBadRequest)
 		return
 	}
 
-	data, err := json.Marshal(authors)
+	authors, err := models.GetAllAuthorsWithFields(r.Context(), fields)
 	if err != nil {
-		handleErrorResponse(w, "Failed to marshal data", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to get authors", err, http.StatusInternalServerError)
 		return
 	}
 
+	data, err := marshalFields(authors, fields)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to marshal data", err, http.StatusInternalServerError)
+		return
+	}
+
+	setCacheControl(w)
 	w.Header().Set("Content-Type", "application/json")
 	_, err = w.Write(data)
 	if err != nil {
-		handleErrorResponse(w, "Failed to write response", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to write response", err, http.StatusInternalServerError)
 		return
 	}
 }
 
 func CreateAuthor(w http.ResponseWriter, r *http.Request) {
 	var author models.Author
-	err := json.NewDecoder(r.Body).Decode(&author)
+	err := decodeJSON(w, r, &author, MaxBodyBytes)
 
 	if err != nil {
-		handleErrorResponse(w, "Failed to decode JSON", err, http.StatusBadRequest)
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
 		return
 	}
-	err = models.CreateAuthor(&author)
+	err = models.CreateAuthor(r.Context(), &author)
 
 	if err != nil {
-		handleErrorResponse(w, "Failed to create author", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to create author", err, http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-
-	responseJSON := map[string]interface{}{
-		"message": "Author created successfully",
-	}
-
-	data, err := json.Marshal(responseJSON)
+	created, err := models.GetAuthor(r.Context(), author.ID)
 	if err != nil {
-		handleErrorResponse(w, "Failed to marshal response", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to get created author", err, http.StatusInternalServerError)
 		return
 	}
 
-	_, err = w.Write(data)
-	if err != nil {
-		log.Printf("Error writing response: %v", err)
-	}
+	w.Header().Set("Location", resourcePath(r, fmt.Sprintf("/authors/%d", created.ID)))
+	respondJSON(w, r, created, http.StatusCreated)
 }
 
 func GetAuthorByID(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	authorID, err := strconv.Atoi(id)
 	if err != nil {
-		handleErrorResponse(w, "Invalid author ID parameter", err, http.StatusBadRequest)
+		handleErrorResponse(w, r, "Invalid author ID parameter", err, http.StatusBadRequest)
 		return
 	}
 
-	author, err := models.GetAuthor(uint(authorID))
+	fields, err := models.ParseAuthorFields(r.URL.Query().Get("fields"), r.URL.Query().Get("include"))
 	if err != nil {
-		handleErrorResponse(w, "Failed to get author", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Invalid fields or include parameter", err, http.StatusBadRequest)
 		return
 	}
 
-	data, err := json.Marshal(author)
+	author, err := models.GetAuthorWithFields(r.Context(), uint(authorID), fields)
 	if err != nil {
-		handleErrorResponse(w, "Failed to marshal data", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to get author", err, http.StatusInternalServerError)
 		return
 	}
 
+	data, err := marshalFields(author, fields)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to marshal data", err, http.StatusInternalServerError)
+		return
+	}
+
+	setCacheControl(w)
 	w.Header().Set("Content-Type", "application/json")
 	_, err = w.Write(data)
 	if err != nil {
-		handleErrorResponse(w, "Failed to write response", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to write response", err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func GetAuthorBooks(w http.ResponseWriter, r *http.Request) {
+	authorID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid author ID parameter", err, http.StatusBadRequest)
 		return
 	}
+
+	_, err = models.GetAuthor(r.Context(), uint(authorID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Author not found", err, http.StatusNotFound)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to get author", err, http.StatusInternalServerError)
+		return
+	}
+
+	respondBooks(w, r, models.BookFilter{AuthorID: uint(authorID)}, models.Sort{})
 }
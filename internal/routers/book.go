@@ -1,36 +1,47 @@
 package routers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/joseph-gunnarsson/book-api/internal/logging"
 	"github.com/joseph-gunnarsson/book-api/internal/models"
+	"gorm.io/gorm"
 )
 
-func BookRoutes(r *chi.Mux) {
-
+func BookRoutes(r chi.Router) {
 	r.Get("/books", GetAllBooks)
 	r.Post("/books", CreateBook)
 	r.Put("/books/{id}", UpdateBook)
+	r.Patch("/books/{id}", UpdateBook)
 	r.Get("/books/{id}", GetBookById)
 	r.Delete("/books/{id}", DeleteBook)
+	r.Post("/books/{id}/genres/{genreID}", AddBookGenre)
+	r.Delete("/books/{id}/genres/{genreID}", RemoveBookGenre)
+	r.Get("/books/{id}/contributors", GetBookContributors)
+	r.Put("/books/{id}/contributors", ReplaceBookContributors)
 }
 
 func DeleteBook(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	bookID, err := strconv.Atoi(id)
 	if err != nil {
-		handleErrorResponse(w, "Invalid book ID parameter", err, http.StatusBadRequest)
+		handleErrorResponse(w, r, "Invalid book ID parameter", err, http.StatusBadRequest)
 		return
 	}
 
-	err = models.DeleteBookByID(uint(bookID))
+	err = models.DeleteBookByID(r.Context(), uint(bookID))
 
 	if err != nil {
-		handleErrorResponse(w, "Failed to delete book", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to delete book", err, http.StatusInternalServerError)
 		return
 	}
 
@@ -41,13 +52,13 @@ func DeleteBook(w http.ResponseWriter, r *http.Request) {
 
 	data, err := json.Marshal(responseJSON)
 	if err != nil {
-		handleErrorResponse(w, "Failed to marshal response", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to marshal response", err, http.StatusInternalServerError)
 		return
 	}
 
 	_, err = w.Write(data)
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
+		logging.FromContext(r.Context()).Error("Failed to write response", "error", err)
 	}
 }
 
@@ -55,124 +66,485 @@ func UpdateBook(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	bookID, err := strconv.Atoi(id)
 	if err != nil {
-		handleErrorResponse(w, "Invalid book ID parameter", err, http.StatusBadRequest)
+		handleErrorResponse(w, r, "Invalid book ID parameter", err, http.StatusBadRequest)
 		return
 	}
 
 	var book models.Book
-	err = json.NewDecoder(r.Body).Decode(&book)
+	keys, err := decodeJSONKeys(w, r, &book, MaxBodyBytes)
 	if err != nil {
-		handleErrorResponse(w, "Failed to decode JSON", err, http.StatusBadRequest)
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
 		return
 	}
 	book.ID = uint(bookID)
 
-	err = models.UpdateBook(&book)
+	err = models.UpdateBook(r.Context(), &book, keys)
 	if err != nil {
-		handleErrorResponse(w, "Failed to update book", err, http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, models.ErrInvalidEdition):
+			handleErrorResponse(w, r, "Invalid edition", err, http.StatusBadRequest)
+		case errors.Is(err, models.ErrInvalidSeries):
+			handleErrorResponse(w, r, "Invalid series", err, http.StatusBadRequest)
+		case errors.Is(err, models.ErrInvalidPublisher):
+			handleErrorResponse(w, r, "Invalid publisher", err, http.StatusBadRequest)
+		case errors.Is(err, models.ErrInvalidContributors):
+			handleErrorResponse(w, r, "Invalid contributors", err, http.StatusBadRequest)
+		default:
+			handleErrorResponse(w, r, "Failed to update book", err, http.StatusInternalServerError)
+		}
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	updated, err := models.GetBookById(r.Context(), bookID)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get updated book", err, http.StatusInternalServerError)
+		return
+	}
 
-	responseJSON := map[string]interface{}{
-		"message": "Book updated successfully",
+	respondJSON(w, r, updated, http.StatusOK)
+}
+
+func handleErrorResponse(w http.ResponseWriter, r *http.Request, errMsg string, err error, statusCode int) {
+	logger := logging.FromContext(r.Context())
+	level := slog.LevelWarn
+	if statusCode >= http.StatusInternalServerError {
+		level = slog.LevelError
 	}
+	logger.Log(r.Context(), level, errMsg, "error", err, "status", statusCode)
+	http.Error(w, errMsg, statusCode)
+}
 
-	data, err := json.Marshal(responseJSON)
+// MaxBodyBytes and MaxBulkBodyBytes bound the size of JSON request bodies
+// for single resources and bulk requests respectively, and
+// MaxImportBodyBytes the size of import uploads.
+var (
+	MaxBodyBytes       int64 = 1 << 20
+	MaxBulkBodyBytes   int64 = 32 << 20
+	MaxImportBodyBytes int64 = 64 << 20
+)
+
+// decodeJSON decodes the request body into v, reading at most limit bytes.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}, limit int64) error {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+// decodeJSONKeys is like decodeJSON but also returns the keys of the JSON
+// object in the body, so that an update can tell a null field, which clears
+// it, from a missing one.
+func decodeJSONKeys(w http.ResponseWriter, r *http.Request, v interface{}, limit int64) (map[string]bool, error) {
+	var body json.RawMessage
+	if err := decodeJSON(w, r, &body, limit); err != nil {
+		return nil, err
+	}
+	return unmarshalKeys(body, v)
+}
+
+// unmarshalKeys decodes the JSON object data into v and returns its keys.
+func unmarshalKeys(data []byte, v interface{}) (map[string]bool, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool, len(object))
+	for key := range object {
+		keys[key] = true
+	}
+	return keys, nil
+}
+
+// decodeStatus returns the status code for an error returned by decodeJSON
+// or by reading an import upload.
+func decodeStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// resourcePath prefixes path with the path the router is mounted at, so
+// that /books/1 becomes /v1/books/1 for a request to /v1/books.
+func resourcePath(r *http.Request, path string) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || len(rctx.RoutePatterns) == 0 {
+		return path
+	}
+	prefix := ""
+	for _, pattern := range rctx.RoutePatterns[:len(rctx.RoutePatterns)-1] {
+		prefix += strings.TrimSuffix(pattern, "/*")
+	}
+	return prefix + path
+}
+
+// CacheMaxAge is how long clients may reuse responses of read endpoints.
+var CacheMaxAge time.Duration
+
+// setCacheControl marks a response of a read endpoint as cacheable for
+// CacheMaxAge, or as needing revalidation if it is zero.
+func setCacheControl(w http.ResponseWriter) {
+	if CacheMaxAge <= 0 {
+		w.Header().Set("Cache-Control", "no-cache")
+		return
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(CacheMaxAge.Seconds())))
+}
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// parsePage reads the limit and offset query parameters. The limit defaults
+// to defaultPageLimit and can't exceed maxPageLimit.
+func parsePage(r *http.Request) (models.Page, error) {
+	page := models.Page{Limit: defaultPageLimit}
+	query := r.URL.Query()
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return models.Page{}, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		page.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return models.Page{}, errors.New("offset must be a non-negative integer")
+		}
+		page.Offset = offset
+	}
+	return page, nil
+}
+
+// respondBooks responds with a page of the books matching filter, sorted by
+// the sort query parameter or else by defaultSort, and limited to the fields
+// and include query parameters.
+func respondBooks(w http.ResponseWriter, r *http.Request, filter models.BookFilter, defaultSort models.Sort) {
+	fields, err := models.ParseBookFields(r.URL.Query().Get("fields"), r.URL.Query().Get("include"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid fields or include parameter", err, http.StatusBadRequest)
+		return
+	}
+	page, err := parsePage(r)
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid pagination parameters", err, http.StatusBadRequest)
+		return
+	}
+	sort, err := models.ParseBookSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid sort parameter", err, http.StatusBadRequest)
+		return
+	}
+	if sort == (models.Sort{}) {
+		sort = defaultSort
+	}
+
+	books, err := models.FindBooksWithFields(r.Context(), filter, sort, page, fields)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get books", err, http.StatusInternalServerError)
+		return
+	}
+
+	data, err := marshalFields(books, fields)
 	if err != nil {
-		handleErrorResponse(w, "Failed to marshal response", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to marshal data", err, http.StatusInternalServerError)
 		return
 	}
 
+	setCacheControl(w)
+	w.Header().Set("Content-Type", "application/json")
 	_, err = w.Write(data)
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
+		logging.FromContext(r.Context()).Error("Failed to write response", "error", err)
 	}
 }
 
-func handleErrorResponse(w http.ResponseWriter, errMsg string, err error, statusCode int) {
-	log.Printf("%s: %v", errMsg, err)
-	http.Error(w, errMsg, statusCode)
+// marshalFields encodes v, a model or a slice of models, keeping only the
+// keys selected by fields.
+func marshalFields(v interface{}, fields models.Fields) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || fields.Keys() == nil {
+		return data, err
+	}
+
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &objects); err != nil {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil, err
+		}
+		return json.Marshal(selectKeys(object, fields.Keys()))
+	}
+	for i, object := range objects {
+		objects[i] = selectKeys(object, fields.Keys())
+	}
+	return json.Marshal(objects)
+}
+
+func selectKeys(object map[string]json.RawMessage, keys []string) map[string]json.RawMessage {
+	selected := make(map[string]json.RawMessage, len(keys))
+	for _, key := range keys {
+		if value, ok := object[key]; ok {
+			selected[key] = value
+		}
+	}
+	return selected
+}
+
+func respondJSON(w http.ResponseWriter, r *http.Request, v interface{}, statusCode int) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to marshal response", err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	_, err = w.Write(data)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to write response", "error", err)
+	}
 }
 
 func GetAllBooks(w http.ResponseWriter, r *http.Request) {
-	books, err := models.GetAllBooks()
+	fields, err := models.ParseBookFields(r.URL.Query().Get("fields"), r.URL.Query().Get("include"))
 	if err != nil {
-		handleErrorResponse(w, "Failed to get books", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Invalid fields or include parameter", err, http.StatusBadRequest)
 		return
 	}
 
-	data, err := json.Marshal(books)
+	var filter models.BookFilter
+	if value := r.URL.Query().Get("publisher"); value != "" {
+		publisherID, err := strconv.Atoi(value)
+		if err != nil {
+			handleErrorResponse(w, r, "Invalid publisher parameter", err, http.StatusBadRequest)
+			return
+		}
+		filter.PublisherID = uint(publisherID)
+	}
+	if value := r.URL.Query().Get("work"); value != "" {
+		workID, err := strconv.Atoi(value)
+		if err != nil {
+			handleErrorResponse(w, r, "Invalid work parameter", err, http.StatusBadRequest)
+			return
+		}
+		filter.WorkID = uint(workID)
+	}
+	filter.Format = r.URL.Query().Get("format")
+	filter.Language = r.URL.Query().Get("language")
+	if value := r.URL.Query().Get("genre"); value != "" {
+		genre, _, err := models.FindGenre(r.Context(), value)
+		switch {
+		case err == nil:
+			filter.GenreID = genre.ID
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// No genre matches, so no book does either.
+			filter.Genre = value
+		default:
+			handleErrorResponse(w, r, "Failed to get genre", err, http.StatusInternalServerError)
+			return
+		}
+	}
+	filter.IncludeSubgenres, err = parseBoolQuery(r, "includeSubgenres")
 	if err != nil {
-		handleErrorResponse(w, "Failed to marshal data", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Invalid includeSubgenres parameter", err, http.StatusBadRequest)
 		return
 	}
 
+	var books []models.Book
+	if fields.Keys() == nil && filter == (models.BookFilter{}) {
+		books, err = models.GetAllBooks(r.Context())
+	} else {
+		books, err = models.FindBooksWithFields(r.Context(), filter, models.Sort{}, models.Page{}, fields)
+	}
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get books", err, http.StatusInternalServerError)
+		return
+	}
+
+	data, err := marshalFields(books, fields)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to marshal data", err, http.StatusInternalServerError)
+		return
+	}
+
+	setCacheControl(w)
 	w.Header().Set("Content-Type", "application/json")
 	_, err = w.Write(data)
 	if err != nil {
-		handleErrorResponse(w, "Failed to write response", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to write response", err, http.StatusInternalServerError)
 		return
 	}
 }
 
 func CreateBook(w http.ResponseWriter, r *http.Request) {
 	var book models.Book
-	err := json.NewDecoder(r.Body).Decode(&book)
+	err := decodeJSON(w, r, &book, MaxBodyBytes)
 
 	if err != nil {
-		handleErrorResponse(w, "Failed to decode json", err, http.StatusBadRequest)
+		handleErrorResponse(w, r, "Failed to decode json", err, decodeStatus(err))
 		return
 	}
-	err = models.CreateBook(&book)
+	err = models.CreateBook(r.Context(), &book)
 
 	if err != nil {
-		handleErrorResponse(w, "Failed to create book", err, http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, models.ErrInvalidEdition):
+			handleErrorResponse(w, r, "Invalid edition", err, http.StatusBadRequest)
+		case errors.Is(err, models.ErrInvalidSeries):
+			handleErrorResponse(w, r, "Invalid series", err, http.StatusBadRequest)
+		case errors.Is(err, models.ErrInvalidPublisher):
+			handleErrorResponse(w, r, "Invalid publisher", err, http.StatusBadRequest)
+		case errors.Is(err, models.ErrInvalidContributors):
+			handleErrorResponse(w, r, "Invalid contributors", err, http.StatusBadRequest)
+		default:
+			handleErrorResponse(w, r, "Failed to create book", err, http.StatusInternalServerError)
+		}
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	created, err := models.GetBookById(r.Context(), int(book.ID))
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get created book", err, http.StatusInternalServerError)
+		return
+	}
 
-	responseJSON := map[string]interface{}{
-		"message": "Book created successfully",
+	w.Header().Set("Location", resourcePath(r, fmt.Sprintf("/books/%d", created.ID)))
+	respondJSON(w, r, created, http.StatusCreated)
+}
+
+func GetBookById(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	fields, err := models.ParseBookFields(r.URL.Query().Get("fields"), r.URL.Query().Get("include"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid fields or include parameter", err, http.StatusBadRequest)
+		return
 	}
 
-	data, err := json.Marshal(responseJSON)
+	book, err := models.GetBookWithFields(r.Context(), id, fields)
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid book ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	data, err := marshalFields(book, fields)
 	if err != nil {
-		handleErrorResponse(w, "Failed to marshal response", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to marshal data", err, http.StatusInternalServerError)
 		return
 	}
 
+	setCacheControl(w)
+	w.Header().Set("Content-Type", "application/json")
 	_, err = w.Write(data)
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
+		handleErrorResponse(w, r, "Failed to write response", err, http.StatusInternalServerError)
+		return
 	}
 
 }
 
-func GetBookById(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+func AddBookGenre(w http.ResponseWriter, r *http.Request) {
+	updateBookGenre(w, r, models.AddBookGenre)
+}
+
+func RemoveBookGenre(w http.ResponseWriter, r *http.Request) {
+	updateBookGenre(w, r, models.RemoveBookGenre)
+}
 
-	book, err := models.GetBookById(id)
+// updateBookGenre adds or removes the genre of the request path using
+// update, and responds with the updated book.
+func updateBookGenre(w http.ResponseWriter, r *http.Request, update func(ctx context.Context, bookID, genreID uint) error) {
+	bookID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		handleErrorResponse(w, "Invalid book ID parameter", err, http.StatusBadRequest)
+		handleErrorResponse(w, r, "Invalid book ID parameter", err, http.StatusBadRequest)
+		return
+	}
+	genreID, err := strconv.Atoi(chi.URLParam(r, "genreID"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid genre ID parameter", err, http.StatusBadRequest)
 		return
 	}
 
-	data, err := json.Marshal(book)
+	err = update(r.Context(), uint(bookID), uint(genreID))
 	if err != nil {
-		handleErrorResponse(w, "Failed to marshal data", err, http.StatusInternalServerError)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Book or genre not found", err, http.StatusNotFound)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to update book genres", err, http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	_, err = w.Write(data)
+	updated, err := models.GetBookById(r.Context(), bookID)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get updated book", err, http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, r, updated, http.StatusOK)
+}
+
+func GetBookContributors(w http.ResponseWriter, r *http.Request) {
+	bookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid book ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	contributors, err := models.GetBookContributors(r.Context(), uint(bookID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Book not found", err, http.StatusNotFound)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to get contributors", err, http.StatusInternalServerError)
+		return
+	}
+
+	setCacheControl(w)
+	respondJSON(w, r, contributors, http.StatusOK)
+}
+
+// ReplaceBookContributors replaces the contributors of a book with the list
+// in the body, whose order is kept.
+func ReplaceBookContributors(w http.ResponseWriter, r *http.Request) {
+	bookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid book ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	var contributors []models.BookContributor
+	err = decodeJSON(w, r, &contributors, MaxBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+
+	err = models.ReplaceBookContributors(r.Context(), uint(bookID), contributors)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			handleErrorResponse(w, r, "Book not found", err, http.StatusNotFound)
+		case errors.Is(err, models.ErrInvalidContributors):
+			handleErrorResponse(w, r, "Invalid contributors", err, http.StatusBadRequest)
+		default:
+			handleErrorResponse(w, r, "Failed to update contributors", err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	updated, err := models.GetBookContributors(r.Context(), uint(bookID))
 	if err != nil {
-		handleErrorResponse(w, "Failed to write response", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to get updated contributors", err, http.StatusInternalServerError)
 		return
 	}
 
+	respondJSON(w, r, updated, http.StatusOK)
 }
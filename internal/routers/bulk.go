@@ -0,0 +1,313 @@
+package routers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+)
+
+const (
+	bulkModeAtomic     = "atomic"
+	bulkModeBestEffort = "best-effort"
+)
+
+type bulkResult struct {
+	Index  int    `json:"index"`
+	ID     uint   `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type bulkResponse struct {
+	Mode      string       `json:"mode"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []bulkResult `json:"results"`
+}
+
+type bulkDeleteRequest struct {
+	IDs []uint `json:"ids"`
+}
+
+func BulkRoutes(r chi.Router) {
+	r.Post("/books/bulk", CreateBooksBulk)
+	r.Put("/books/bulk", UpdateBooksBulk)
+	r.Delete("/books/bulk", DeleteBooksBulk)
+	r.Post("/authors/bulk", CreateAuthorsBulk)
+	r.Put("/authors/bulk", UpdateAuthorsBulk)
+	r.Delete("/authors/bulk", DeleteAuthorsBulk)
+	r.Post("/genres/bulk", CreateGenresBulk)
+	r.Put("/genres/bulk", UpdateGenresBulk)
+	r.Delete("/genres/bulk", DeleteGenresBulk)
+}
+
+// parseBulkMode reads the mode query parameter. Bulk requests are all or
+// nothing unless the client asks for best-effort processing.
+func parseBulkMode(r *http.Request) (string, error) {
+	mode := r.URL.Query().Get("mode")
+	switch mode {
+	case "":
+		return bulkModeAtomic, nil
+	case bulkModeAtomic, bulkModeBestEffort:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown bulk mode %q", mode)
+}
+
+func writeBulkResponse(w http.ResponseWriter, r *http.Request, mode string, ids []uint, errs []error, err error, status string, statusCode int) {
+	if err != nil && !errors.Is(err, models.ErrBulkAborted) {
+		handleErrorResponse(w, r, "Failed to process bulk request", err, http.StatusInternalServerError)
+		return
+	}
+
+	response := bulkResponse{
+		Mode:    mode,
+		Results: make([]bulkResult, len(ids)),
+	}
+	for i, id := range ids {
+		result := bulkResult{Index: i, ID: id, Status: status}
+		switch {
+		case errs[i] != nil:
+			result.Status = "failed"
+			result.Error = errs[i].Error()
+		case err != nil:
+			result.Status = "rolledBack"
+		}
+
+		if result.Status == status {
+			response.Succeeded++
+		} else {
+			response.Failed++
+			// IDs of unsaved new items are meaningless.
+			if status == "created" {
+				result.ID = 0
+			}
+		}
+		response.Results[i] = result
+	}
+
+	if err != nil {
+		if !hasItemError(errs) {
+			// The failing item is unknown, e.g. a batched insert was
+			// rejected by the database, so report the cause on every item.
+			for i := range response.Results {
+				response.Results[i].Error = err.Error()
+			}
+		}
+		respondJSON(w, r, response, http.StatusUnprocessableEntity)
+		return
+	}
+	if response.Failed > 0 {
+		// Partially applied best-effort requests are reported as a whole.
+		statusCode = http.StatusOK
+	}
+	respondJSON(w, r, response, statusCode)
+}
+
+func hasItemError(errs []error) bool {
+	for _, err := range errs {
+		if err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func CreateBooksBulk(w http.ResponseWriter, r *http.Request) {
+	mode, err := parseBulkMode(r)
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid bulk mode", err, http.StatusBadRequest)
+		return
+	}
+
+	var books []models.Book
+	err = decodeJSON(w, r, &books, MaxBulkBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+
+	errs, err := models.CreateBooks(r.Context(), books, mode == bulkModeAtomic)
+	ids := make([]uint, len(books))
+	for i, book := range books {
+		ids[i] = book.ID
+	}
+	writeBulkResponse(w, r, mode, ids, errs, err, "created", http.StatusCreated)
+}
+
+func UpdateBooksBulk(w http.ResponseWriter, r *http.Request) {
+	mode, err := parseBulkMode(r)
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid bulk mode", err, http.StatusBadRequest)
+		return
+	}
+
+	var objects []json.RawMessage
+	err = decodeJSON(w, r, &objects, MaxBulkBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+	books := make([]models.Book, len(objects))
+	keys := make([]map[string]bool, len(objects))
+	for i, object := range objects {
+		keys[i], err = unmarshalKeys(object, &books[i])
+		if err != nil {
+			handleErrorResponse(w, r, "Failed to decode JSON", err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	errs, err := models.UpdateBooks(r.Context(), books, keys, mode == bulkModeAtomic)
+	ids := make([]uint, len(books))
+	for i, book := range books {
+		ids[i] = book.ID
+	}
+	writeBulkResponse(w, r, mode, ids, errs, err, "updated", http.StatusOK)
+}
+
+func DeleteBooksBulk(w http.ResponseWriter, r *http.Request) {
+	mode, err := parseBulkMode(r)
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid bulk mode", err, http.StatusBadRequest)
+		return
+	}
+
+	var request bulkDeleteRequest
+	err = decodeJSON(w, r, &request, MaxBulkBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+
+	errs, err := models.DeleteBooksByID(r.Context(), request.IDs, mode == bulkModeAtomic)
+	writeBulkResponse(w, r, mode, request.IDs, errs, err, "deleted", http.StatusOK)
+}
+
+func CreateAuthorsBulk(w http.ResponseWriter, r *http.Request) {
+	mode, err := parseBulkMode(r)
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid bulk mode", err, http.StatusBadRequest)
+		return
+	}
+
+	var authors []models.Author
+	err = decodeJSON(w, r, &authors, MaxBulkBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+
+	errs, err := models.CreateAuthors(r.Context(), authors, mode == bulkModeAtomic)
+	ids := make([]uint, len(authors))
+	for i, author := range authors {
+		ids[i] = author.ID
+	}
+	writeBulkResponse(w, r, mode, ids, errs, err, "created", http.StatusCreated)
+}
+
+func UpdateAuthorsBulk(w http.ResponseWriter, r *http.Request) {
+	mode, err := parseBulkMode(r)
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid bulk mode", err, http.StatusBadRequest)
+		return
+	}
+
+	var authors []models.Author
+	err = decodeJSON(w, r, &authors, MaxBulkBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+
+	errs, err := models.UpdateAuthors(r.Context(), authors, mode == bulkModeAtomic)
+	ids := make([]uint, len(authors))
+	for i, author := range authors {
+		ids[i] = author.ID
+	}
+	writeBulkResponse(w, r, mode, ids, errs, err, "updated", http.StatusOK)
+}
+
+func DeleteAuthorsBulk(w http.ResponseWriter, r *http.Request) {
+	mode, err := parseBulkMode(r)
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid bulk mode", err, http.StatusBadRequest)
+		return
+	}
+
+	var request bulkDeleteRequest
+	err = decodeJSON(w, r, &request, MaxBulkBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+
+	errs, err := models.DeleteAuthorsByID(r.Context(), request.IDs, mode == bulkModeAtomic)
+	writeBulkResponse(w, r, mode, request.IDs, errs, err, "deleted", http.StatusOK)
+}
+
+func CreateGenresBulk(w http.ResponseWriter, r *http.Request) {
+	mode, err := parseBulkMode(r)
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid bulk mode", err, http.StatusBadRequest)
+		return
+	}
+
+	var genres []models.Genre
+	err = decodeJSON(w, r, &genres, MaxBulkBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+
+	errs, err := models.CreateGenres(r.Context(), genres, mode == bulkModeAtomic)
+	ids := make([]uint, len(genres))
+	for i, genre := range genres {
+		ids[i] = genre.ID
+	}
+	writeBulkResponse(w, r, mode, ids, errs, err, "created", http.StatusCreated)
+}
+
+func UpdateGenresBulk(w http.ResponseWriter, r *http.Request) {
+	mode, err := parseBulkMode(r)
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid bulk mode", err, http.StatusBadRequest)
+		return
+	}
+
+	var genres []models.Genre
+	err = decodeJSON(w, r, &genres, MaxBulkBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+
+	errs, err := models.UpdateGenres(r.Context(), genres, mode == bulkModeAtomic)
+	ids := make([]uint, len(genres))
+	for i, genre := range genres {
+		ids[i] = genre.ID
+	}
+	writeBulkResponse(w, r, mode, ids, errs, err, "updated", http.StatusOK)
+}
+
+func DeleteGenresBulk(w http.ResponseWriter, r *http.Request) {
+	mode, err := parseBulkMode(r)
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid bulk mode", err, http.StatusBadRequest)
+		return
+	}
+
+	var request bulkDeleteRequest
+	err = decodeJSON(w, r, &request, MaxBulkBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+
+	errs, err := models.DeleteGenresByID(r.Context(), request.IDs, mode == bulkModeAtomic)
+	writeBulkResponse(w, r, mode, request.IDs, errs, err, "deleted", http.StatusOK)
+}
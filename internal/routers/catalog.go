@@ -0,0 +1,125 @@
+package routers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/joseph-gunnarsson/book-api/internal/catalog"
+	"github.com/joseph-gunnarsson/book-api/internal/logging"
+)
+
+func CatalogRoutes(r chi.Router) {
+	r.Get("/books/export", ExportBooks)
+	r.Post("/books/import", ImportBooks)
+}
+
+func ExportBooks(w http.ResponseWriter, r *http.Request) {
+	format, err := catalog.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		handleErrorResponse(w, r, "Unsupported export format", err, http.StatusBadRequest)
+		return
+	}
+
+	liftDeadlines(w, r)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="books%s"`, format.FileExtension()))
+
+	// The status line is sent with the first batch, so a failure halfway
+	// through can only be logged.
+	err = catalog.Export(r.Context(), w, format)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to export books", "error", err)
+	}
+}
+
+func ImportBooks(w http.ResponseWriter, r *http.Request) {
+	format, err := catalog.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		handleErrorResponse(w, r, "Unsupported import format", err, http.StatusBadRequest)
+		return
+	}
+
+	dryRun, err := parseBoolQuery(r, "dryRun")
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid dryRun parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	liftDeadlines(w, r)
+	body, err := importBody(w, r)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to read import file", err, decodeStatus(err))
+		return
+	}
+	defer body.Close()
+
+	records, rowErrors, err := catalog.Read(body, format)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to parse import file", err, decodeStatus(err))
+		return
+	}
+
+	report, err := catalog.Import(r.Context(), records, catalog.ImportOptions{DryRun: dryRun})
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to import books", err, http.StatusInternalServerError)
+		return
+	}
+	report.AddErrors(rowErrors)
+
+	if r.URL.Query().Get("report") == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="import-errors.csv"`)
+		err = catalog.WriteErrorReport(w, report.Errors)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Failed to write response", "error", err)
+		}
+		return
+	}
+
+	statusCode := http.StatusCreated
+	if dryRun {
+		statusCode = http.StatusOK
+	}
+	respondJSON(w, r, report, statusCode)
+}
+
+// importBody returns the uploaded file, either sent as the raw request body
+// or as the "file" field of a multipart form. At most MaxImportBodyBytes are
+// read from the request.
+func importBody(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImportBodyBytes)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		return file, nil
+	}
+	return r.Body, nil
+}
+
+// liftDeadlines removes the server's read and write timeouts for a request
+// that uploads or streams a whole catalogue, which can take much longer than
+// a normal request.
+func liftDeadlines(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		logging.FromContext(r.Context()).Warn("Failed to lift read deadline", "error", err)
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logging.FromContext(r.Context()).Warn("Failed to lift write deadline", "error", err)
+	}
+}
+
+func parseBoolQuery(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
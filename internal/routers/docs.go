@@ -0,0 +1,171 @@
+package routers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/joseph-gunnarsson/book-api/internal/logging"
+)
+
+// openAPIDocument describes every route registered by this package. It is
+// edited by hand; CheckRoutes catches routes that are missing from it.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// swaggerUI holds the Swagger UI assets served under /docs, so the docs
+// page doesn't load scripts from a third party. They are vendored from the
+// swagger-ui-dist package by go generate; update the version there.
+//
+//go:generate sh -c "curl -sSfL https://registry.npmjs.org/swagger-ui-dist/-/swagger-ui-dist-5.17.14.tgz | tar -xz -C swagger-ui --strip-components=1 package/LICENSE package/swagger-ui.css package/swagger-ui-bundle.js"
+//go:embed swagger-ui
+var swaggerUI embed.FS
+
+// swaggerUIAssets are the files of swaggerUI that GetDocsAsset serves.
+var swaggerUIAssets = map[string]string{
+	"swagger-ui.css":       "text/css; charset=utf-8",
+	"swagger-ui-bundle.js": "text/javascript; charset=utf-8",
+}
+
+// docsScript starts Swagger UI. Its hash is allowed by the page's content
+// security policy, so no other inline script can run.
+const docsScript = `window.onload = function () {
+  window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+};`
+
+var docsPage = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Book API</title>
+  <link rel="stylesheet" href="/docs/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="/docs/swagger-ui-bundle.js"></script>
+  <script>{{.Script}}</script>
+</body>
+</html>
+`))
+
+var docsContentSecurityPolicy = fmt.Sprintf(
+	"default-src 'none'; script-src 'self' 'sha256-%s'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; connect-src 'self'; frame-ancestors 'none'",
+	scriptHash(docsScript),
+)
+
+func DocsRoutes(r chi.Router) {
+	r.Get("/openapi.json", GetOpenAPIDocument)
+	r.Get("/docs", GetDocs)
+	r.Get("/docs/{asset}", GetDocsAsset)
+}
+
+func GetOpenAPIDocument(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.Write(openAPIDocument)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to write response", "error", err)
+	}
+}
+
+// GetDocs serves a Swagger UI page for the OpenAPI document.
+func GetDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", docsContentSecurityPolicy)
+	err := docsPage.Execute(w, struct {
+		Script template.JS
+	}{template.JS(docsScript)})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Failed to write response", "error", err)
+	}
+}
+
+// GetDocsAsset serves the Swagger UI stylesheet and script used by the docs
+// page.
+func GetDocsAsset(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "asset")
+	contentType, ok := swaggerUIAssets[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	content, err := swaggerUI.ReadFile(path.Join("swagger-ui", name))
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to read docs asset", err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+}
+
+// CheckRoutes returns an error listing the routes registered on routes that
+// the OpenAPI document doesn't describe, and the operations it describes
+// that aren't registered. The package tests run it against the server's
+// routes so that a route can't be added without documenting it.
+func CheckRoutes(routes chi.Routes) error {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPIDocument, &spec); err != nil {
+		return fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+
+	documented := make(map[string]bool)
+	for path, item := range spec.Paths {
+		for method := range item {
+			switch method {
+			case "get", "put", "post", "delete", "options", "head", "patch", "trace":
+				documented[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+
+	var missing []string
+	err := chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		operation := method + " " + route
+		if documented[operation] {
+			delete(documented, operation)
+		} else {
+			missing = append(missing, operation)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		problems = append(problems, "undocumented routes: "+strings.Join(missing, ", "))
+	}
+	if len(documented) > 0 {
+		var stale []string
+		for operation := range documented {
+			stale = append(stale, operation)
+		}
+		sort.Strings(stale)
+		problems = append(problems, "documented routes that don't exist: "+strings.Join(stale, ", "))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("OpenAPI document is out of date: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func scriptHash(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
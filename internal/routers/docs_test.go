@@ -0,0 +1,54 @@
+package routers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/joseph-gunnarsson/book-api/internal/metrics"
+)
+
+// TestRoutesAreDocumented registers the routes the way cmd/app does and
+// checks them against the OpenAPI document.
+func TestRoutesAreDocumented(t *testing.T) {
+	r := chi.NewRouter()
+	r.Method(http.MethodGet, "/metrics", metrics.Handler())
+	HealthRoutes(r)
+	DocsRoutes(r)
+	r.Route("/v1", V1Routes)
+	r.Group(GraphQLRoutes)
+
+	if err := CheckRoutes(r); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDocsAssets requests every stylesheet and script the docs page links
+// to, so that assets missing from swagger-ui are caught.
+func TestDocsAssets(t *testing.T) {
+	r := chi.NewRouter()
+	DocsRoutes(r)
+
+	page := httptest.NewRecorder()
+	r.ServeHTTP(page, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if page.Code != http.StatusOK {
+		t.Fatalf("GET /docs: got status %d, want %d", page.Code, http.StatusOK)
+	}
+
+	links := regexp.MustCompile(`(?:href|src)="(/docs/[^"]+)"`).FindAllStringSubmatch(page.Body.String(), -1)
+	if len(links) == 0 {
+		t.Fatal("GET /docs: page links to no assets")
+	}
+	for _, link := range links {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link[1], nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s: got status %d, want %d", link[1], w.Code, http.StatusOK)
+		}
+		if w.Body.Len() == 0 {
+			t.Errorf("GET %s: empty body", link[1])
+		}
+	}
+}
@@ -2,54 +2,58 @@ package routers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/joseph-gunnarsson/book-api/internal/logging"
 	"github.com/joseph-gunnarsson/book-api/internal/models"
+	"gorm.io/gorm"
 )
 
-func GenreRoutes(r *chi.Mux) {
+func GenreRoutes(r chi.Router) {
 	r.Get("/genres", GetAllGenres)
 	r.Post("/genres", CreateGenre)
-	r.Get("/genres/{name}", getGenreByName)
-	r.Put("/genres/{name}", UpdateGenre)
-	r.Delete("/genres/{name}", DeleteGenre)
+	r.Get("/genres/{genre}", getGenre)
+	r.Put("/genres/{genre}", UpdateGenre)
+	r.Patch("/genres/{genre}", UpdateGenre)
+	r.Delete("/genres/{genre}", DeleteGenre)
+	r.Get("/genres/{genre}/books", GetGenreBooks)
+	r.Get("/genres/{genre}/tree", GetGenreTree)
+	r.Put("/genres/{genre}/parent", MoveGenre)
 }
 
-func getGenreByName(w http.ResponseWriter, r *http.Request) {
-	name := chi.URLParam(r, "name")
-
-	genre, err := models.GetGenreByName(name)
-	if err != nil {
-		handleErrorResponse(w, "Failed to get genre", err, http.StatusBadRequest)
+func getGenre(w http.ResponseWriter, r *http.Request) {
+	genre, ok := genreFromPath(w, r)
+	if !ok {
 		return
 	}
 
 	data, err := json.Marshal(genre)
 
 	if err != nil {
-		handleErrorResponse(w, "Failed to marshal response", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to marshal response", err, http.StatusInternalServerError)
 		return
 	}
 
+	setCacheControl(w)
 	_, err = w.Write(data)
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
+		logging.FromContext(r.Context()).Error("Failed to write response", "error", err)
 	}
 }
 
 func DeleteGenre(w http.ResponseWriter, r *http.Request) {
-	name := chi.URLParam(r, "name")
-	genre, err := models.GetGenreByName(name)
-	if err != nil {
-		handleErrorResponse(w, "Failed to get genre", err, http.StatusBadRequest)
+	genre, ok := genreFromPath(w, r)
+	if !ok {
 		return
 	}
 
-	err = models.DeleteGenre(&genre)
+	err := models.DeleteGenre(r.Context(), &genre)
 	if err != nil {
-		handleErrorResponse(w, "Failed to delete genre", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to delete genre", err, http.StatusInternalServerError)
 		return
 	}
 
@@ -60,103 +64,232 @@ func DeleteGenre(w http.ResponseWriter, r *http.Request) {
 
 	data, err := json.Marshal(responseJSON)
 	if err != nil {
-		handleErrorResponse(w, "Failed to marshal response", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to marshal response", err, http.StatusInternalServerError)
 		return
 	}
 
 	_, err = w.Write(data)
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
+		logging.FromContext(r.Context()).Error("Failed to write response", "error", err)
 	}
 }
 
+// UpdateGenre updates a genre. A new name renames the genre and changes
+// its slug, and the old slug redirects to the new one.
 func UpdateGenre(w http.ResponseWriter, r *http.Request) {
-	name := chi.URLParam(r, "name")
+	existing, ok := genreFromPath(w, r)
+	if !ok {
+		return
+	}
 
 	var genre models.Genre
-	err := json.NewDecoder(r.Body).Decode(&genre)
+	err := decodeJSON(w, r, &genre, MaxBodyBytes)
 	if err != nil {
-		handleErrorResponse(w, "Failed to decode JSON", err, http.StatusBadRequest)
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
 		return
 	}
-	genre.Genre = name
+	genre.ID = existing.ID
 
-	err = models.UpdateGenre(&genre)
+	err = models.UpdateGenre(r.Context(), &genre)
 	if err != nil {
-		handleErrorResponse(w, "Failed to update genre", err, http.StatusInternalServerError)
+		if errors.Is(err, models.ErrInvalidGenreParent) {
+			handleErrorResponse(w, r, "Invalid parent genre", err, http.StatusBadRequest)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to update genre", err, http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
-	responseJSON := map[string]interface{}{
-		"message": "Genre updated successfully",
-	}
-
-	data, err := json.Marshal(responseJSON)
+	updated, err := models.GetGenre(r.Context(), existing.ID)
 	if err != nil {
-		handleErrorResponse(w, "Failed to marshal response", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to get updated genre", err, http.StatusInternalServerError)
 		return
 	}
 
-	_, err = w.Write(data)
-	if err != nil {
-		log.Printf("Error writing response: %v", err)
-	}
+	respondJSON(w, r, updated, http.StatusOK)
 }
 
+// GetAllGenres lists all genres, or with tree=true the top-level genres
+// with their subgenres nested.
 func GetAllGenres(w http.ResponseWriter, r *http.Request) {
-	genres, err := models.GetAllGenre()
+	tree, err := parseBoolQuery(r, "tree")
 	if err != nil {
-		handleErrorResponse(w, "Failed to get genres", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Invalid tree parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	var genres []models.Genre
+	if tree {
+		genres, err = models.GetGenreTree(r.Context())
+	} else {
+		genres, err = models.GetAllGenre(r.Context())
+	}
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get genres", err, http.StatusInternalServerError)
 		return
 	}
 
 	data, err := json.Marshal(genres)
 	if err != nil {
-		handleErrorResponse(w, "Failed to marshal data", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to marshal data", err, http.StatusInternalServerError)
 		return
 	}
 
+	setCacheControl(w)
 	w.Header().Set("Content-Type", "application/json")
 	_, err = w.Write(data)
 	if err != nil {
-		handleErrorResponse(w, "Failed to write response", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Failed to write response", err, http.StatusInternalServerError)
 		return
 	}
 }
 
 func CreateGenre(w http.ResponseWriter, r *http.Request) {
 	var genre models.Genre
-	err := json.NewDecoder(r.Body).Decode(&genre)
+	err := decodeJSON(w, r, &genre, MaxBodyBytes)
 
 	if err != nil {
-		handleErrorResponse(w, "Failed to decode JSON", err, http.StatusBadRequest)
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
 		return
 	}
-	err = models.CreateGenre(&genre)
+	err = models.CreateGenre(r.Context(), &genre)
 
 	if err != nil {
-		handleErrorResponse(w, "Failed to create genre", err, http.StatusInternalServerError)
+		if errors.Is(err, models.ErrInvalidGenreParent) {
+			handleErrorResponse(w, r, "Invalid parent genre", err, http.StatusBadRequest)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to create genre", err, http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	created, err := models.GetGenre(r.Context(), genre.ID)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get created genre", err, http.StatusInternalServerError)
+		return
+	}
 
-	responseJSON := map[string]interface{}{
-		"message": "Genre created successfully",
+	w.Header().Set("Location", resourcePath(r, "/genres/"+url.PathEscape(created.Slug)))
+	respondJSON(w, r, created, http.StatusCreated)
+}
+
+func GetGenreBooks(w http.ResponseWriter, r *http.Request) {
+	genre, ok := genreFromPath(w, r)
+	if !ok {
+		return
 	}
 
-	data, err := json.Marshal(responseJSON)
+	includeSubgenres, err := parseBoolQuery(r, "includeSubgenres")
 	if err != nil {
-		handleErrorResponse(w, "Failed to marshal response", err, http.StatusInternalServerError)
+		handleErrorResponse(w, r, "Invalid includeSubgenres parameter", err, http.StatusBadRequest)
 		return
 	}
 
-	_, err = w.Write(data)
+	respondBooks(w, r, models.BookFilter{GenreID: genre.ID, IncludeSubgenres: includeSubgenres}, models.Sort{})
+}
+
+// GetGenreTree responds with a genre and its subgenres nested.
+func GetGenreTree(w http.ResponseWriter, r *http.Request) {
+	genre, ok := genreFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	tree, err := models.GetGenreSubtree(r.Context(), genre)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get genre tree", err, http.StatusInternalServerError)
+		return
+	}
+
+	setCacheControl(w)
+	respondJSON(w, r, tree, http.StatusOK)
+}
+
+// MoveGenre makes a genre a subgenre of the parentID in the body, or a
+// top-level genre if parentID is null.
+func MoveGenre(w http.ResponseWriter, r *http.Request) {
+	genre, ok := genreFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		ParentID *uint `json:"parentID"`
+	}
+	err := decodeJSON(w, r, &body, MaxBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+
+	err = models.MoveGenre(r.Context(), &genre, body.ParentID)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidGenreParent) {
+			handleErrorResponse(w, r, "Invalid parent genre", err, http.StatusBadRequest)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to move genre", err, http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := models.GetGenre(r.Context(), genre.ID)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get updated genre", err, http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, r, updated, http.StatusOK)
+}
+
+// genreFromPath loads the genre of the {genre} path parameter, an ID or a
+// slug. Requests using a former slug, or a name as genres were addressed
+// before slugs existed, are redirected to the genre's current slug. It
+// returns false if it has responded, with an error or a redirect.
+func genreFromPath(w http.ResponseWriter, r *http.Request) (models.Genre, bool) {
+	genre, moved, err := models.FindGenre(r.Context(), pathParam(r, "genre"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Genre not found", err, http.StatusNotFound)
+			return models.Genre{}, false
+		}
+		handleErrorResponse(w, r, "Failed to get genre", err, http.StatusInternalServerError)
+		return models.Genre{}, false
+	}
+	if moved {
+		redirectToGenre(w, r, genre)
+		return models.Genre{}, false
+	}
+	return genre, true
+}
+
+// redirectToGenre redirects to the same route for the current slug of
+// genre. Only GET and HEAD requests may be changed to GET by clients
+// following a 301, so other methods get a 308.
+func redirectToGenre(w http.ResponseWriter, r *http.Request, genre models.Genre) {
+	pattern := chi.RouteContext(r.Context()).RoutePattern()
+	location := strings.Replace(pattern, "{genre}", url.PathEscape(genre.Slug), 1)
+	if r.URL.RawQuery != "" {
+		location += "?" + r.URL.RawQuery
+	}
+
+	status := http.StatusMovedPermanently
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		status = http.StatusPermanentRedirect
+	}
+	http.Redirect(w, r, location, status)
+}
+
+// pathParam returns a path parameter unescaped. chi matches the escaped
+// path when the request path has escapes that differ from the default
+// encoding, like %2F, and leaves parameters escaped.
+func pathParam(r *http.Request, key string) string {
+	value := chi.URLParam(r, key)
+	if r.URL.RawPath == "" {
+		return value
+	}
+	unescaped, err := url.PathUnescape(value)
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
+		return value
 	}
+	return unescaped
 }
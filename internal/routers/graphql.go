@@ -0,0 +1,34 @@
+package routers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/joseph-gunnarsson/book-api/internal/graph"
+)
+
+var graphSchema = graph.NewSchema()
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func GraphQLRoutes(r chi.Router) {
+	r.Post("/graphql", GraphQL)
+}
+
+// GraphQL executes a query or mutation. As usual for GraphQL, errors from
+// resolvers are reported in the response body with a 200 status.
+func GraphQL(w http.ResponseWriter, r *http.Request) {
+	var request graphQLRequest
+	err := decodeJSON(w, r, &request, MaxBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+
+	response := graphSchema.Exec(graph.WithLoaders(r.Context()), request.Query, request.OperationName, request.Variables)
+	respondJSON(w, r, response, http.StatusOK)
+}
@@ -0,0 +1,97 @@
+package routers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/joseph-gunnarsson/book-api/internal/database"
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+var (
+	shuttingDown      atomic.Bool
+	migrationsApplied atomic.Bool
+)
+
+type healthCheck struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks,omitempty"`
+}
+
+func HealthRoutes(r chi.Router) {
+	r.Get("/healthz", Healthz)
+	r.Get("/readyz", Readyz)
+}
+
+// SetShuttingDown makes the readiness check fail so that load balancers stop
+// sending new requests while in-flight ones are drained.
+func SetShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+// Healthz reports that the process is alive. It doesn't check dependencies,
+// so a database outage doesn't get the process restarted.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, r, healthResponse{Status: "ok"}, http.StatusOK)
+}
+
+// Readyz reports whether the server can handle requests.
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	response := healthResponse{
+		Status: "ok",
+		Checks: map[string]healthCheck{
+			"database":   checkDatabase(ctx),
+			"migrations": checkMigrations(ctx),
+		},
+	}
+	if shuttingDown.Load() {
+		response.Checks["shutdown"] = healthCheck{Status: "failing", Error: "server is shutting down"}
+	}
+
+	statusCode := http.StatusOK
+	for _, check := range response.Checks {
+		if check.Status != "ok" {
+			response.Status = "unavailable"
+			statusCode = http.StatusServiceUnavailable
+		}
+	}
+	respondJSON(w, r, response, statusCode)
+}
+
+func checkDatabase(ctx context.Context) healthCheck {
+	start := time.Now()
+	err := database.Ping(ctx)
+	check := healthCheck{Status: "ok", Latency: time.Since(start).String()}
+	if err != nil {
+		check.Status = "failing"
+		check.Error = err.Error()
+	}
+	return check
+}
+
+// checkMigrations looks for the tables of all models. Tables aren't dropped
+// while the server runs, so once they exist the check isn't repeated.
+func checkMigrations(ctx context.Context) healthCheck {
+	if migrationsApplied.Load() {
+		return healthCheck{Status: "ok"}
+	}
+	if err := models.CheckMigrations(ctx); err != nil {
+		return healthCheck{Status: "failing", Error: err.Error()}
+	}
+	migrationsApplied.Store(true)
+	return healthCheck{Status: "ok"}
+}
@@ -0,0 +1,108 @@
+package routers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/joseph-gunnarsson/book-api/internal/catalog"
+	"github.com/joseph-gunnarsson/book-api/internal/jobs"
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+	"gorm.io/gorm"
+)
+
+func ImportRoutes(r chi.Router) {
+	r.Post("/imports", CreateImport)
+	r.Get("/imports/{id}", GetImport)
+	r.Delete("/imports/{id}", CancelImport)
+}
+
+func CreateImport(w http.ResponseWriter, r *http.Request) {
+	format, err := catalog.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		handleErrorResponse(w, r, "Unsupported import format", err, http.StatusBadRequest)
+		return
+	}
+
+	dryRun, err := parseBoolQuery(r, "dryRun")
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid dryRun parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	liftDeadlines(w, r)
+	body, err := importBody(w, r)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to read import file", err, decodeStatus(err))
+		return
+	}
+	defer body.Close()
+
+	payload, err := io.ReadAll(body)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to read import file", err, decodeStatus(err))
+		return
+	}
+
+	job := models.ImportJob{
+		Format:  string(format),
+		DryRun:  dryRun,
+		Payload: payload,
+	}
+	err = jobs.Submit(r.Context(), &job)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to create import job", err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", resourcePath(r, fmt.Sprintf("/imports/%d", job.ID)))
+	respondJSON(w, r, job, http.StatusAccepted)
+}
+
+func GetImport(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	jobID, err := strconv.Atoi(id)
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid import job ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	job, err := models.GetImportJob(r.Context(), uint(jobID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Import job not found", err, http.StatusNotFound)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to get import job", err, http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, r, job, http.StatusOK)
+}
+
+func CancelImport(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	jobID, err := strconv.Atoi(id)
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid import job ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	job, err := jobs.Cancel(r.Context(), uint(jobID))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			handleErrorResponse(w, r, "Import job not found", err, http.StatusNotFound)
+		case errors.Is(err, models.ErrImportJobFinished):
+			handleErrorResponse(w, r, "Import job has already finished", err, http.StatusConflict)
+		default:
+			handleErrorResponse(w, r, "Failed to cancel import job", err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	respondJSON(w, r, job, http.StatusOK)
+}
@@ -0,0 +1,152 @@
+package routers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+	"gorm.io/gorm"
+)
+
+func PublisherRoutes(r chi.Router) {
+	r.Get("/publishers", GetAllPublishers)
+	r.Post("/publishers", CreatePublisher)
+	r.Get("/publishers/{id}", GetPublisherByID)
+	r.Put("/publishers/{id}", UpdatePublisher)
+	r.Patch("/publishers/{id}", UpdatePublisher)
+	r.Delete("/publishers/{id}", DeletePublisher)
+}
+
+func GetAllPublishers(w http.ResponseWriter, r *http.Request) {
+	publishers, err := models.GetAllPublishers(r.Context())
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get publishers", err, http.StatusInternalServerError)
+		return
+	}
+
+	setCacheControl(w)
+	respondJSON(w, r, publishers, http.StatusOK)
+}
+
+func GetPublisherByID(w http.ResponseWriter, r *http.Request) {
+	publisherID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid publisher ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	publisher, err := models.GetPublisher(r.Context(), uint(publisherID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Publisher not found", err, http.StatusNotFound)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to get publisher", err, http.StatusInternalServerError)
+		return
+	}
+
+	setCacheControl(w)
+	respondJSON(w, r, publisher, http.StatusOK)
+}
+
+func CreatePublisher(w http.ResponseWriter, r *http.Request) {
+	var publisher models.Publisher
+	err := decodeJSON(w, r, &publisher, MaxBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+	publisher.ID = 0
+
+	err = models.CreatePublisher(r.Context(), &publisher)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidParent) {
+			handleErrorResponse(w, r, "Invalid parent publisher", err, http.StatusBadRequest)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to create publisher", err, http.StatusInternalServerError)
+		return
+	}
+
+	created, err := models.GetPublisher(r.Context(), publisher.ID)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get created publisher", err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", resourcePath(r, fmt.Sprintf("/publishers/%d", created.ID)))
+	respondJSON(w, r, created, http.StatusCreated)
+}
+
+func UpdatePublisher(w http.ResponseWriter, r *http.Request) {
+	publisherID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid publisher ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	_, err = models.GetPublisher(r.Context(), uint(publisherID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Publisher not found", err, http.StatusNotFound)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to get publisher", err, http.StatusInternalServerError)
+		return
+	}
+
+	var publisher models.Publisher
+	keys, err := decodeJSONKeys(w, r, &publisher, MaxBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+	publisher.ID = uint(publisherID)
+
+	err = models.UpdatePublisher(r.Context(), &publisher, keys["parentID"])
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidParent) {
+			handleErrorResponse(w, r, "Invalid parent publisher", err, http.StatusBadRequest)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to update publisher", err, http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := models.GetPublisher(r.Context(), uint(publisherID))
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get updated publisher", err, http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, r, updated, http.StatusOK)
+}
+
+func DeletePublisher(w http.ResponseWriter, r *http.Request) {
+	publisherID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid publisher ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	publisher, err := models.GetPublisher(r.Context(), uint(publisherID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Publisher not found", err, http.StatusNotFound)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to get publisher", err, http.StatusInternalServerError)
+		return
+	}
+
+	err = models.DeletePublisher(r.Context(), &publisher)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to delete publisher", err, http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, r, map[string]interface{}{"message": "Publisher deleted successfully"}, http.StatusOK)
+}
@@ -0,0 +1,17 @@
+package routers
+
+import "github.com/go-chi/chi/v5"
+
+// V1Routes registers the resources of version 1 of the API, which the
+// server mounts at /v1.
+func V1Routes(r chi.Router) {
+	BookRoutes(r)
+	GenreRoutes(r)
+	AuthorRoutes(r)
+	PublisherRoutes(r)
+	SeriesRoutes(r)
+	WorkRoutes(r)
+	BulkRoutes(r)
+	CatalogRoutes(r)
+	ImportRoutes(r)
+}
@@ -0,0 +1,167 @@
+package routers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+	"gorm.io/gorm"
+)
+
+func SeriesRoutes(r chi.Router) {
+	r.Get("/series", GetAllSeries)
+	r.Post("/series", CreateSeries)
+	r.Get("/series/{id}", GetSeriesByID)
+	r.Put("/series/{id}", UpdateSeries)
+	r.Patch("/series/{id}", UpdateSeries)
+	r.Delete("/series/{id}", DeleteSeries)
+	r.Get("/series/{id}/books", GetSeriesBooks)
+}
+
+func GetAllSeries(w http.ResponseWriter, r *http.Request) {
+	series, err := models.GetAllSeries(r.Context())
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get series", err, http.StatusInternalServerError)
+		return
+	}
+
+	setCacheControl(w)
+	respondJSON(w, r, series, http.StatusOK)
+}
+
+func GetSeriesByID(w http.ResponseWriter, r *http.Request) {
+	seriesID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid series ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	series, err := models.GetSeries(r.Context(), uint(seriesID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Series not found", err, http.StatusNotFound)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to get series", err, http.StatusInternalServerError)
+		return
+	}
+
+	setCacheControl(w)
+	respondJSON(w, r, series, http.StatusOK)
+}
+
+func CreateSeries(w http.ResponseWriter, r *http.Request) {
+	var series models.Series
+	err := decodeJSON(w, r, &series, MaxBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+	series.ID = 0
+
+	err = models.CreateSeries(r.Context(), &series)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to create series", err, http.StatusInternalServerError)
+		return
+	}
+
+	created, err := models.GetSeries(r.Context(), series.ID)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get created series", err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", resourcePath(r, fmt.Sprintf("/series/%d", created.ID)))
+	respondJSON(w, r, created, http.StatusCreated)
+}
+
+func UpdateSeries(w http.ResponseWriter, r *http.Request) {
+	seriesID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid series ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	_, err = models.GetSeries(r.Context(), uint(seriesID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Series not found", err, http.StatusNotFound)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to get series", err, http.StatusInternalServerError)
+		return
+	}
+
+	var series models.Series
+	err = decodeJSON(w, r, &series, MaxBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+	series.ID = uint(seriesID)
+
+	err = models.UpdateSeries(r.Context(), &series)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to update series", err, http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := models.GetSeries(r.Context(), uint(seriesID))
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get updated series", err, http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, r, updated, http.StatusOK)
+}
+
+func DeleteSeries(w http.ResponseWriter, r *http.Request) {
+	seriesID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid series ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	series, err := models.GetSeries(r.Context(), uint(seriesID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Series not found", err, http.StatusNotFound)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to get series", err, http.StatusInternalServerError)
+		return
+	}
+
+	err = models.DeleteSeries(r.Context(), &series)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to delete series", err, http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, r, map[string]interface{}{"message": "Series deleted successfully"}, http.StatusOK)
+}
+
+// GetSeriesBooks lists the books of a series in reading order, unless the
+// sort query parameter asks otherwise.
+func GetSeriesBooks(w http.ResponseWriter, r *http.Request) {
+	seriesID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid series ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	_, err = models.GetSeries(r.Context(), uint(seriesID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Series not found", err, http.StatusNotFound)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to get series", err, http.StatusInternalServerError)
+		return
+	}
+
+	respondBooks(w, r, models.BookFilter{SeriesID: uint(seriesID)}, models.Sort{Column: "series_position"})
+}
@@ -0,0 +1,173 @@
+package routers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/joseph-gunnarsson/book-api/internal/models"
+	"gorm.io/gorm"
+)
+
+func WorkRoutes(r chi.Router) {
+	r.Get("/works", GetAllWorks)
+	r.Post("/works", CreateWork)
+	r.Get("/works/{id}", GetWorkByID)
+	r.Put("/works/{id}", UpdateWork)
+	r.Patch("/works/{id}", UpdateWork)
+	r.Delete("/works/{id}", DeleteWork)
+	r.Get("/works/{id}/editions", GetWorkEditions)
+}
+
+func GetAllWorks(w http.ResponseWriter, r *http.Request) {
+	works, err := models.GetAllWorks(r.Context())
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get works", err, http.StatusInternalServerError)
+		return
+	}
+
+	setCacheControl(w)
+	respondJSON(w, r, works, http.StatusOK)
+}
+
+func GetWorkByID(w http.ResponseWriter, r *http.Request) {
+	workID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid work ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	work, err := models.GetWork(r.Context(), uint(workID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Work not found", err, http.StatusNotFound)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to get work", err, http.StatusInternalServerError)
+		return
+	}
+
+	setCacheControl(w)
+	respondJSON(w, r, work, http.StatusOK)
+}
+
+func CreateWork(w http.ResponseWriter, r *http.Request) {
+	var work models.Work
+	err := decodeJSON(w, r, &work, MaxBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+	work.ID = 0
+
+	err = models.CreateWork(r.Context(), &work)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to create work", err, http.StatusInternalServerError)
+		return
+	}
+
+	created, err := models.GetWork(r.Context(), work.ID)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get created work", err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", resourcePath(r, fmt.Sprintf("/works/%d", created.ID)))
+	respondJSON(w, r, created, http.StatusCreated)
+}
+
+func UpdateWork(w http.ResponseWriter, r *http.Request) {
+	workID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid work ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	err = models.CheckWork(r.Context(), uint(workID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Work not found", err, http.StatusNotFound)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to get work", err, http.StatusInternalServerError)
+		return
+	}
+
+	var work models.Work
+	err = decodeJSON(w, r, &work, MaxBodyBytes)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to decode JSON", err, decodeStatus(err))
+		return
+	}
+	work.ID = uint(workID)
+
+	err = models.UpdateWork(r.Context(), &work)
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to update work", err, http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := models.GetWork(r.Context(), uint(workID))
+	if err != nil {
+		handleErrorResponse(w, r, "Failed to get updated work", err, http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, r, updated, http.StatusOK)
+}
+
+func DeleteWork(w http.ResponseWriter, r *http.Request) {
+	workID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid work ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	err = models.CheckWork(r.Context(), uint(workID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Work not found", err, http.StatusNotFound)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to get work", err, http.StatusInternalServerError)
+		return
+	}
+
+	var work models.Work
+	work.ID = uint(workID)
+	err = models.DeleteWork(r.Context(), &work)
+	if err != nil {
+		if errors.Is(err, models.ErrWorkHasEditions) {
+			handleErrorResponse(w, r, "Work still has editions", err, http.StatusConflict)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to delete work", err, http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, r, map[string]interface{}{"message": "Work deleted successfully"}, http.StatusOK)
+}
+
+// GetWorkEditions lists the editions of a work from oldest to newest,
+// unless the sort query parameter asks otherwise.
+func GetWorkEditions(w http.ResponseWriter, r *http.Request) {
+	workID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		handleErrorResponse(w, r, "Invalid work ID parameter", err, http.StatusBadRequest)
+		return
+	}
+
+	err = models.CheckWork(r.Context(), uint(workID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handleErrorResponse(w, r, "Work not found", err, http.StatusNotFound)
+			return
+		}
+		handleErrorResponse(w, r, "Failed to get work", err, http.StatusInternalServerError)
+		return
+	}
+
+	respondBooks(w, r, models.BookFilter{WorkID: uint(workID)}, models.Sort{Column: "release_date"})
+}